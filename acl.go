@@ -0,0 +1,357 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ACLRules builds the rules of ACL SETUSER, they are applied in order
+//
+//	rules := NewACLRules().Reset().On().AddPassword(secret).Keys("orders:*").AllowCategory("read")
+//	err := client.ACLSetUser("orders-service", rules)
+type ACLRules struct {
+	rules []string
+}
+
+// NewACLRules starts an empty list of rules
+func NewACLRules() *ACLRules {
+	return &ACLRules{}
+}
+
+func (r *ACLRules) add(rules ...string) *ACLRules {
+	r.rules = append(r.rules, rules...)
+	return r
+}
+
+// Rules returns the rules in the syntax of ACL SETUSER, none for nil rules
+func (r *ACLRules) Rules() []string {
+	if r == nil {
+		return nil
+	}
+	return r.rules
+}
+
+// Reset removes every capability of the user and turns it off
+func (r *ACLRules) Reset() *ACLRules {
+	return r.add("reset")
+}
+
+// On enables the user
+func (r *ACLRules) On() *ACLRules {
+	return r.add("on")
+}
+
+// Off disables the user, it can no longer authenticate
+func (r *ACLRules) Off() *ACLRules {
+	return r.add("off")
+}
+
+// AddPassword adds a valid password of the user
+func (r *ACLRules) AddPassword(password string) *ACLRules {
+	return r.add(">" + password)
+}
+
+// RemovePassword removes a valid password of the user
+func (r *ACLRules) RemovePassword(password string) *ACLRules {
+	return r.add("<" + password)
+}
+
+// NoPass allows the user to authenticate with any password
+func (r *ACLRules) NoPass() *ACLRules {
+	return r.add("nopass")
+}
+
+// ResetPass removes every password of the user
+func (r *ACLRules) ResetPass() *ACLRules {
+	return r.add("resetpass")
+}
+
+// Keys allows reading and writing the keys matching the glob-style patterns
+func (r *ACLRules) Keys(patterns ...string) *ACLRules {
+	for _, p := range patterns {
+		r.add("~" + p)
+	}
+	return r
+}
+
+// ReadKeys allows reading the keys matching the glob-style patterns, since redis 7
+func (r *ACLRules) ReadKeys(patterns ...string) *ACLRules {
+	for _, p := range patterns {
+		r.add("%R~" + p)
+	}
+	return r
+}
+
+// WriteKeys allows writing the keys matching the glob-style patterns, since redis 7
+func (r *ACLRules) WriteKeys(patterns ...string) *ACLRules {
+	for _, p := range patterns {
+		r.add("%W~" + p)
+	}
+	return r
+}
+
+// AllKeys allows every key
+func (r *ACLRules) AllKeys() *ACLRules {
+	return r.add("allkeys")
+}
+
+// ResetKeys removes every key pattern
+func (r *ACLRules) ResetKeys() *ACLRules {
+	return r.add("resetkeys")
+}
+
+// Channels allows the pub/sub channels matching the glob-style patterns
+func (r *ACLRules) Channels(patterns ...string) *ACLRules {
+	for _, p := range patterns {
+		r.add("&" + p)
+	}
+	return r
+}
+
+// AllChannels allows every pub/sub channel
+func (r *ACLRules) AllChannels() *ACLRules {
+	return r.add("allchannels")
+}
+
+// ResetChannels removes every channel pattern
+func (r *ACLRules) ResetChannels() *ACLRules {
+	return r.add("resetchannels")
+}
+
+// AllowCategory allows the commands of the categories, e.g. read, write, admin, see ACLCat
+func (r *ACLRules) AllowCategory(categories ...string) *ACLRules {
+	for _, c := range categories {
+		r.add("+@" + c)
+	}
+	return r
+}
+
+// DenyCategory denies the commands of the categories
+func (r *ACLRules) DenyCategory(categories ...string) *ACLRules {
+	for _, c := range categories {
+		r.add("-@" + c)
+	}
+	return r
+}
+
+// AllowCommand allows the commands, or subcommands in the command|subcommand form
+func (r *ACLRules) AllowCommand(commands ...string) *ACLRules {
+	for _, c := range commands {
+		r.add("+" + strings.ToLower(c))
+	}
+	return r
+}
+
+// DenyCommand denies the commands, or subcommands in the command|subcommand form
+func (r *ACLRules) DenyCommand(commands ...string) *ACLRules {
+	for _, c := range commands {
+		r.add("-" + strings.ToLower(c))
+	}
+	return r
+}
+
+// AllCommands allows every command
+func (r *ACLRules) AllCommands() *ACLRules {
+	return r.add("allcommands")
+}
+
+// NoCommands denies every command
+func (r *ACLRules) NoCommands() *ACLRules {
+	return r.add("nocommands")
+}
+
+// ACLSetUser creates the user, or modifies it if it exists, applying rules
+// nil rules create the user with the defaults, or leave an existing user unchanged
+func (rc *RedisClient) ACLSetUser(username string, rules *ACLRules) error {
+	_, err := rc.executeCommand("ACL", append([]string{"SETUSER", username}, rules.Rules()...)...)
+	return err
+}
+
+// ACLUser describes a user, as returned by ACL GETUSER
+type ACLUser struct {
+	// Flags such as on, off, nopass
+	Flags []string
+	// Passwords are the SHA-256 hashes of the passwords
+	Passwords []string
+	// Commands, Keys and Channels are the rules of the user, e.g. "+@all -debug", "~orders:*", "&*"
+	Commands string
+	Keys     string
+	Channels string
+	// Selectors are the additional sets of rules of the user, since redis 7
+	Selectors []map[string]string
+}
+
+// ACLGetUser returns the rules of the user
+// returns nil if the user does not exist
+func (rc *RedisClient) ACLGetUser(username string) (*ACLUser, error) {
+	reply, err := rc.executeCommand("ACL", "GETUSER", username)
+	if err != nil {
+		return nil, err
+	}
+	if reply.arrayVal == nil {
+		return nil, nil
+	}
+	return parseACLUser(reply), nil
+}
+
+func parseACLUser(reply *Reply) *ACLUser {
+	u := &ACLUser{}
+	for k, v := range reply.mapVal() {
+		switch k {
+		case "flags":
+			u.Flags = v.stringsVal()
+		case "passwords":
+			u.Passwords = v.stringsVal()
+		case "commands":
+			u.Commands = string(v.stringVal)
+		case "keys":
+			u.Keys = aclPatterns(v)
+		case "channels":
+			u.Channels = aclPatterns(v)
+		case "selectors":
+			for _, s := range v.arrayVal {
+				selector := make(map[string]string)
+				for sk, sv := range s.mapVal() {
+					selector[sk] = aclPatterns(sv)
+				}
+				u.Selectors = append(u.Selectors, selector)
+			}
+		}
+	}
+	return u
+}
+
+// aclPatterns returns patterns as a string, redis 6 returns them as an array, without their ~ or & prefix
+func aclPatterns(r *Reply) string {
+	if r.arrayVal == nil {
+		return string(r.stringVal)
+	}
+	return strings.Join(r.stringsVal(), " ")
+}
+
+// ACLDelUser deletes the users and closes their connections
+// returns the number of deleted users
+func (rc *RedisClient) ACLDelUser(usernames ...string) (int64, error) {
+	reply, err := rc.executeCommand("ACL", append([]string{"DELUSER"}, usernames...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// ACLList returns the users and their rules in the ACL file format, one user per element
+func (rc *RedisClient) ACLList() ([]string, error) {
+	reply, err := rc.executeCommand("ACL", "LIST")
+	if err != nil {
+		return nil, err
+	}
+	return reply.stringsVal(), nil
+}
+
+// ACLUsers returns the names of the users
+func (rc *RedisClient) ACLUsers() ([]string, error) {
+	reply, err := rc.executeCommand("ACL", "USERS")
+	if err != nil {
+		return nil, err
+	}
+	return reply.stringsVal(), nil
+}
+
+// ACLWhoAmI returns the user of the connection executing the command
+func (rc *RedisClient) ACLWhoAmI() (string, error) {
+	reply, err := rc.executeCommand("ACL", "WHOAMI")
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// ACLCat returns the command categories, or the commands of category if it is given
+func (rc *RedisClient) ACLCat(category ...string) ([]string, error) {
+	reply, err := rc.executeCommand("ACL", append([]string{"CAT"}, category...)...)
+	if err != nil {
+		return nil, err
+	}
+	return reply.stringsVal(), nil
+}
+
+// ACLLogEntry is a security event, a command or an authentication denied by the ACLs
+type ACLLogEntry struct {
+	Count int64
+	// Reason is command, key, channel or auth
+	Reason string
+	// Context is toplevel, multi, lua or module
+	Context string
+	// Object is the denied command, key or channel
+	Object   string
+	Username string
+	Age      time.Duration
+	Client   *ClientInfo
+	// EntryID, Created and LastUpdated are set since redis 7.2
+	EntryID     int64
+	Created     time.Time
+	LastUpdated time.Time
+}
+
+// ACLLog returns the count most recent security events, or the default number if count is negative
+func (rc *RedisClient) ACLLog(count int) ([]ACLLogEntry, error) {
+	args := []string{"LOG"}
+	if count >= 0 {
+		args = append(args, strconv.Itoa(count))
+	}
+	reply, err := rc.executeCommand("ACL", args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ACLLogEntry, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		var e ACLLogEntry
+		for k, v := range r.mapVal() {
+			switch k {
+			case "count":
+				e.Count = v.integerVal
+			case "reason":
+				e.Reason = string(v.stringVal)
+			case "context":
+				e.Context = string(v.stringVal)
+			case "object":
+				e.Object = string(v.stringVal)
+			case "username":
+				e.Username = string(v.stringVal)
+			case "age-seconds":
+				age, _ := strconv.ParseFloat(string(v.stringVal), 64)
+				e.Age = time.Duration(age * float64(time.Second))
+			case "client-info":
+				e.Client = parseClientInfo(string(v.stringVal))
+			case "entry-id":
+				e.EntryID = v.integerVal
+			case "timestamp-created":
+				e.Created = time.UnixMilli(v.integerVal)
+			case "timestamp-last-updated":
+				e.LastUpdated = time.UnixMilli(v.integerVal)
+			}
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// ACLLogReset empties the security events log
+func (rc *RedisClient) ACLLogReset() error {
+	_, err := rc.executeCommand("ACL", "LOG", "RESET")
+	return err
+}
+
+// ACLDryRun simulates the execution of a command by the user, since redis 7
+// returns an empty string if the user is allowed to run it, the reason of the denial otherwise
+func (rc *RedisClient) ACLDryRun(username, command string, args ...string) (string, error) {
+	reply, err := rc.executeCommand("ACL", append([]string{"DRYRUN", username, command}, args...)...)
+	if err != nil {
+		return "", err
+	}
+	if string(reply.stringVal) == "OK" {
+		return "", nil
+	}
+	return string(reply.stringVal), nil
+}
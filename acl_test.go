@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	rules := NewACLRules().Reset().On().AddPassword("secret").Keys("orders:*").Channels("events").AllowCategory("read").DenyCommand("KEYS")
+	expected := "[reset on >secret ~orders:* &events +@read -keys]"
+	if fmt.Sprint(rules.Rules()) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, rules.Rules())
+	}
+	b := bytes.NewBufferString("*10\r\n$5\r\nflags\r\n*1\r\n$2\r\non\r\n$9\r\npasswords\r\n*0\r\n$8\r\ncommands\r\n$6\r\n+@read\r\n$4\r\nkeys\r\n$9\r\n~orders:*\r\n$8\r\nchannels\r\n$7\r\n&events\r\n")
+	reply, _ := NewRESPReader(b).ReadResp()
+	u := parseACLUser(reply)
+	if fmt.Sprint(u.Flags) != "[on]" || u.Commands != "+@read" || u.Keys != "~orders:*" || u.Channels != "&events" {
+		t.Errorf("test failed, got: %+v", u)
+	}
+}
+
+func TestACLSetUser(t *testing.T) {
+	var received []string
+	client := newFakeClient(t, func(cmd []string) string {
+		received = append(received, strings.Join(cmd, " "))
+		return "+OK\r\n"
+	})
+	if err := client.ACLSetUser("svc", nil); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	if err := client.ACLSetUser("svc", NewACLRules().On().NoPass()); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	expected := "[ACL SETUSER svc ACL SETUSER svc on nopass]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, received)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// BitRangeUnit is the unit of the start and end of a BitRange
+type BitRangeUnit string
+
+const (
+	// BitRangeByte counts the range in bytes, the default
+	BitRangeByte BitRangeUnit = "BYTE"
+	// BitRangeBit counts the range in bits, since redis 7
+	BitRangeBit BitRangeUnit = "BIT"
+)
+
+// BitRange restricts BITCOUNT and BITPOS to a part of the string, negative indexes count from the end
+type BitRange struct {
+	Start int64
+	End   int64
+	Unit  BitRangeUnit
+}
+
+func (br *BitRange) args() []string {
+	if br == nil {
+		return nil
+	}
+	args := []string{strconv.FormatInt(br.Start, 10), strconv.FormatInt(br.End, 10)}
+	if br.Unit != "" {
+		args = append(args, string(br.Unit))
+	}
+	return args
+}
+
+// SetBit sets or clears the bit at offset in the string value stored at key
+// returns the original bit value
+func (rc *RedisClient) SetBit(key string, offset int64, value int) (int64, error) {
+	reply, err := rc.executeCommand("SETBIT", key, strconv.FormatInt(offset, 10), strconv.Itoa(value))
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// GetBit returns the bit value at offset in the string value stored at key
+func (rc *RedisClient) GetBit(key string, offset int64) (int64, error) {
+	reply, err := rc.executeCommand("GETBIT", key, strconv.FormatInt(offset, 10))
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// BitCount counts the set bits of the string stored at key, within br unless it is nil
+func (rc *RedisClient) BitCount(key string, br *BitRange) (int64, error) {
+	reply, err := rc.executeCommand("BITCOUNT", append([]string{key}, br.args()...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// BitPos returns the position of the first bit set to bit, 1 or 0, in the string stored at key, within br unless it is nil
+// returns -1 when no such bit is found
+func (rc *RedisClient) BitPos(key string, bit int, br *BitRange) (int64, error) {
+	reply, err := rc.executeCommand("BITPOS", append([]string{key, strconv.Itoa(bit)}, br.args()...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// BitOperation is a bitwise operation of BITOP
+type BitOperation string
+
+// bitwise operations of BITOP
+const (
+	BitAnd BitOperation = "AND"
+	BitOr  BitOperation = "OR"
+	BitXor BitOperation = "XOR"
+	BitNot BitOperation = "NOT"
+)
+
+// BitOp performs op between the strings stored at keys and stores the result at dest, NOT takes a single key
+// returns the size of the string stored at dest
+func (rc *RedisClient) BitOp(op BitOperation, dest string, keys ...string) (int64, error) {
+	reply, err := rc.executeCommand("BITOP", append([]string{string(op), dest}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// BitFieldType is the type of an integer of a bitfield, e.g. i8 or u16
+type BitFieldType string
+
+// Signed returns the type of a signed integer of bits bits, up to 64
+func Signed(bits int) BitFieldType {
+	return BitFieldType("i" + strconv.Itoa(bits))
+}
+
+// Unsigned returns the type of an unsigned integer of bits bits, up to 63
+func Unsigned(bits int) BitFieldType {
+	return BitFieldType("u" + strconv.Itoa(bits))
+}
+
+// BitFieldOverflow is the behavior of the BITFIELD SET and INCRBY operations which follow it on overflow
+type BitFieldOverflow string
+
+const (
+	// BitFieldWrap wraps around, the default
+	BitFieldWrap BitFieldOverflow = "WRAP"
+	// BitFieldSat saturates to the minimum or maximum value
+	BitFieldSat BitFieldOverflow = "SAT"
+	// BitFieldFail does nothing and returns a nil result, reported as 0
+	BitFieldFail BitFieldOverflow = "FAIL"
+)
+
+// BitField builds a BITFIELD command, its operations are executed in order by Exec
+//
+//	res, err := client.BitField("counters").Overflow(BitFieldSat).IncrBy(Unsigned(8), 0, 1).Get(Unsigned(8), 8).Exec()
+type BitField struct {
+	rc       *RedisClient
+	key      string
+	readOnly bool
+	args     []string
+	err      error
+}
+
+// BitField starts a BITFIELD command on key
+func (rc *RedisClient) BitField(key string) *BitField {
+	return &BitField{rc: rc, key: key}
+}
+
+// BitFieldRO starts a BITFIELD_RO command on key, which only supports Get
+func (rc *RedisClient) BitFieldRO(key string) *BitField {
+	return &BitField{rc: rc, key: key, readOnly: true}
+}
+
+// Get returns the integer of type t at the bit offset
+func (bf *BitField) Get(t BitFieldType, offset int64) *BitField {
+	bf.args = append(bf.args, "GET", string(t), strconv.FormatInt(offset, 10))
+	return bf
+}
+
+// Set sets the integer of type t at the bit offset to value, its result is the old value
+func (bf *BitField) Set(t BitFieldType, offset int64, value int64) *BitField {
+	bf.write()
+	bf.args = append(bf.args, "SET", string(t), strconv.FormatInt(offset, 10), strconv.FormatInt(value, 10))
+	return bf
+}
+
+// IncrBy increments the integer of type t at the bit offset, its result is the new value
+func (bf *BitField) IncrBy(t BitFieldType, offset int64, increment int64) *BitField {
+	bf.write()
+	bf.args = append(bf.args, "INCRBY", string(t), strconv.FormatInt(offset, 10), strconv.FormatInt(increment, 10))
+	return bf
+}
+
+// Overflow sets the overflow behavior of the following Set and IncrBy
+func (bf *BitField) Overflow(o BitFieldOverflow) *BitField {
+	bf.write()
+	bf.args = append(bf.args, "OVERFLOW", string(o))
+	return bf
+}
+
+func (bf *BitField) write() {
+	if bf.readOnly && bf.err == nil {
+		bf.err = errors.New("BITFIELD_RO only supports GET")
+	}
+}
+
+// Exec sends the command
+// returns one result per Get, Set and IncrBy, in order
+func (bf *BitField) Exec() ([]int64, error) {
+	if bf.err != nil {
+		return nil, bf.err
+	}
+	command := "BITFIELD"
+	if bf.readOnly {
+		command = "BITFIELD_RO"
+	}
+	reply, err := bf.rc.executeCommand(command, append([]string{bf.key}, bf.args...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]int64, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		res = append(res, r.integerVal)
+	}
+	return res, nil
+}
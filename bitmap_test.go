@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBitField(t *testing.T) {
+	var sent []string
+	client := newFakeClient(t, func(cmd []string) string {
+		sent = cmd
+		return "*2\r\n:255\r\n:3\r\n"
+	})
+	res, err := client.BitField("dau").Overflow(BitFieldSat).IncrBy(Unsigned(8), 0, 300).Get(Signed(4), 8).Exec()
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	expected := "[BITFIELD dau OVERFLOW SAT INCRBY u8 0 300 GET i4 8]"
+	if fmt.Sprint(sent) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, sent)
+	}
+	if len(res) != 2 || res[0] != 255 || res[1] != 3 {
+		t.Errorf("test failed, expected: [255 3], got: %v", res)
+	}
+	if _, err := client.BitFieldRO("dau").Set(Unsigned(8), 0, 1).Exec(); err == nil {
+		t.Errorf("test failed, expected not nil, got: nil")
+	}
+}
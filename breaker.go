@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of dialing a node whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets the commands through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails the commands with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen fails the commands with ErrCircuitOpen while a PING probes the node
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerOptions configures the circuit breakers of WithCircuitBreaker
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive network errors after which the breaker opens, 5 by default
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before probing the node, and bounds the probe, 1 second by default
+	OpenTimeout time.Duration
+	// OnStateChange is called with the host:port address of the node when its breaker changes state
+	OnStateChange func(addr string, from, to CircuitState)
+}
+
+// WithCircuitBreaker adds a circuit breaker to every connection pool of the client, one per node for the
+// cluster, ring and replica clients. Once a node has failed FailureThreshold dials or commands in a row
+// with a network error, its commands fail with ErrCircuitOpen instead of waiting for the dial to time out.
+// After OpenTimeout the breaker becomes half-open and dials the node to send a PING:
+// it closes if the node answers and opens again otherwise.
+func WithCircuitBreaker(opts BreakerOptions) Option {
+	return func(rc *RedisClient) {
+		if opts.FailureThreshold <= 0 {
+			opts.FailureThreshold = 5
+		}
+		if opts.OpenTimeout <= 0 {
+			opts.OpenTimeout = time.Second
+		}
+		rc.breakerOpts = &opts
+	}
+}
+
+// circuitBreaker guards the connections of a pool
+type circuitBreaker struct {
+	opts BreakerOptions
+	pool *ConnPool
+	mu   sync.Mutex
+	// consecutive failures while closed
+	failures int
+	state    CircuitState
+	done     chan struct{}
+}
+
+// newCircuitBreaker returns a breaker of pool, nil when opts is nil
+func newCircuitBreaker(opts *BreakerOptions, pool *ConnPool) *circuitBreaker {
+	if opts == nil {
+		return nil
+	}
+	return &circuitBreaker{opts: *opts, pool: pool, done: make(chan struct{})}
+}
+
+// allow returns ErrCircuitOpen unless the breaker is closed
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != CircuitClosed {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record counts the outcome of a dial or a command, err being nil or a network error
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	if b.state != CircuitClosed {
+		// a command started before the breaker opened
+		b.mu.Unlock()
+		return
+	}
+	if err == nil {
+		b.failures = 0
+		b.mu.Unlock()
+		return
+	}
+	b.failures++
+	trip := b.failures >= b.opts.FailureThreshold
+	b.mu.Unlock()
+	if trip && b.transition(CircuitClosed, CircuitOpen) {
+		go b.recover()
+	}
+}
+
+// transition changes the state of the breaker from from to to
+// returns false when the breaker is not in state from
+func (b *circuitBreaker) transition(from, to CircuitState) bool {
+	b.mu.Lock()
+	if b.state != from {
+		b.mu.Unlock()
+		return false
+	}
+	b.state = to
+	b.failures = 0
+	b.mu.Unlock()
+	if b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.pool.addr(), from, to)
+	}
+	return true
+}
+
+// recover probes the node every OpenTimeout until it answers, the breaker is reset or stopped
+func (b *circuitBreaker) recover() {
+	timer := time.NewTimer(b.opts.OpenTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-timer.C:
+		}
+		if !b.transition(CircuitOpen, CircuitHalfOpen) {
+			return
+		}
+		if b.pool.ping(b.opts.OpenTimeout) == nil {
+			b.transition(CircuitHalfOpen, CircuitClosed)
+			return
+		}
+		if !b.transition(CircuitHalfOpen, CircuitOpen) {
+			return
+		}
+		timer.Reset(b.opts.OpenTimeout)
+	}
+}
+
+// reset closes the breaker, e.g. when the pool is pointed at another node
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	from := b.state
+	b.mu.Unlock()
+	if from != CircuitClosed {
+		b.transition(from, CircuitClosed)
+	}
+}
+
+func (b *circuitBreaker) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var down int32 = 1
+	var mu sync.Mutex
+	var transitions []string
+	client := newFakeClient(t, func(cmd []string) string {
+		if atomic.LoadInt32(&down) == 1 {
+			return ""
+		}
+		return "+PONG\r\n"
+	}, WithCircuitBreaker(BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Millisecond,
+		OnStateChange: func(addr string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	}))
+	for i := 0; i < 2; i++ {
+		if _, err := client.Ping(); err == nil || err == ErrCircuitOpen {
+			t.Errorf("test failed, expected network error, got: %v", err)
+		}
+	}
+	if _, err := client.Ping(); err != ErrCircuitOpen {
+		t.Errorf("test failed, expected: %s, got: %v", ErrCircuitOpen, err)
+	}
+	atomic.StoreInt32(&down, 0)
+	deadline := time.Now().Add(time.Second)
+	var err error
+	for {
+		if _, err = client.Ping(); err != ErrCircuitOpen || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transitions) < 3 || transitions[0] != "closed->open" || transitions[1] != "open->half-open" ||
+		transitions[len(transitions)-1] != "half-open->closed" {
+		t.Errorf("test failed, expected: closed->open ... half-open->closed, got: %v", transitions)
+	}
+}
+
+func TestCircuitBreakerPipeline(t *testing.T) {
+	host, port := newFakeServer(t, func(cmd []string) string {
+		return ""
+	})
+	pool := NewConnPool(host, port, 1)
+	pool.breaker = newCircuitBreaker(&BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Hour}, pool)
+	defer pool.Close()
+	// the network errors of the pipelines of the cluster and ring clients count
+	for i := 0; i < 2; i++ {
+		cmd := &Cmd{args: []string{"GET", "k"}}
+		if execCmds(pool, []*Cmd{cmd}); cmd.err == nil || cmd.err == ErrCircuitOpen {
+			t.Errorf("test failed, expected network error, got: %v", cmd.err)
+		}
+	}
+	if _, err := pool.GetConn(); err != ErrCircuitOpen {
+		t.Errorf("test failed, expected: %s, got: %v", ErrCircuitOpen, err)
+	}
+}
+
+func TestCircuitBreakerProbeTimeout(t *testing.T) {
+	// a node accepting the connections without ever replying
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	pool := NewConnPool(host, port, 1)
+	defer pool.Close()
+	done := make(chan error, 1)
+	go func() { done <- pool.ping(20 * time.Millisecond) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("test failed, expected error, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("test failed, expected the probe to time out")
+	}
+}
+
+func TestCircuitBreakerTransactions(t *testing.T) {
+	client := newFakeClient(t, func(cmd []string) string {
+		return ""
+	}, WithCircuitBreaker(BreakerOptions{FailureThreshold: 3, OpenTimeout: time.Hour}))
+	// the network errors of the pipelines and the transactions count when they are closed
+	p, _ := client.Pipeline()
+	p.AddCommand("GET", "k")
+	if _, err := p.Exec(); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	p.Close()
+	tp, _ := client.TxPipeline()
+	tp.AddCommand("GET", "k")
+	if _, err := tp.Exec(); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	tp.Close()
+	tx, _ := client.Transaction()
+	if err := tx.AddCommand("GET", "k"); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	tx.Close()
+	if _, err := client.Ping(); err != ErrCircuitOpen {
+		t.Errorf("test failed, expected: %s, got: %v", ErrCircuitOpen, err)
+	}
+	if stats := client.PoolStats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("test failed, expected: no connection, got: %+v", stats)
+	}
+}
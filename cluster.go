@@ -0,0 +1,483 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClusterSlots is the number of hash slots of a Redis Cluster
+const ClusterSlots = 16384
+
+// clusterRetryBackoff is the wait before the first retry of a command failing with TRYAGAIN, CLUSTERDOWN or a network error,
+// doubled on every retry
+const clusterRetryBackoff = 25 * time.Millisecond
+
+// WithMaxRedirects sets how many MOVED and ASK redirections a ClusterClient follows for a command,
+// and how many times it retries a command failing with TRYAGAIN, CLUSTERDOWN or a network error
+func WithMaxRedirects(n int) Option {
+	return func(rc *RedisClient) {
+		rc.maxRedirects = n
+	}
+}
+
+// ClusterSlot returns the hash slot of key
+// Only the part between the first { and the next } is hashed when it is not empty,
+// so that keys sharing this hash tag, e.g. {user1000}.following and {user1000}.followers, are on the same node.
+func ClusterSlot(key string) int {
+	return int(crc16(hashTag(key))) % ClusterSlots
+}
+
+// hashTag returns the part of key between the first { and the next }, or key if it is empty or missing
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// clusterShard is a master node and its replicas, serving a range of slots
+type clusterShard struct {
+	master   string
+	replicas []string
+}
+
+// ClusterClient is a client of a Redis Cluster, the commands of the embedded RedisClient are sent to
+// the master serving the slot of their first key, or to any node when they have no key.
+// Transactions, pubsub and the other helpers holding a connection run on the first node given to NewClusterClient.
+type ClusterClient struct {
+	*RedisClient
+	seeds []string
+	mu    sync.RWMutex
+	slots [ClusterSlots]*clusterShard
+	nodes map[string]*ConnPool
+	// a slot map reload is in progress
+	reloading int32
+	// closed by Close, stops the slot map reloads
+	done chan struct{}
+}
+
+// NewClusterClient returns a client of the Redis Cluster reachable at the host:port addresses of addrs,
+// the slot map is loaded from the first reachable one
+func NewClusterClient(addrs []string, opts ...Option) (*ClusterClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no cluster address")
+	}
+	cc := &ClusterClient{
+		seeds: addrs,
+		nodes: make(map[string]*ConnPool),
+		done:  make(chan struct{}),
+	}
+	cc.RedisClient = newRedisClient(cc.nodePool(addrs[0]), opts)
+	cc.RedisClient.process = cc.process
+	if cc.replicas != nil {
+		// replicas of a cluster only serve reads on connections in read-only mode
+		cc.replicas.initCmds = [][]string{{"READONLY"}}
+	}
+	if err := cc.loadSlots(); err != nil {
+		cc.Close()
+		return nil, err
+	}
+	if reply, err := cc.onAnyNode([]string{"COMMAND"}); err == nil {
+		cc.commands, _ = parseCommandInfos(reply)
+	}
+	if err := cc.start(); err != nil {
+		cc.Close()
+		return nil, err
+	}
+	return cc, nil
+}
+
+// nodePool returns the pool of the node at addr, creating it if needed
+func (cc *ClusterClient) nodePool(addr string) *ConnPool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if pool, ok := cc.nodes[addr]; ok {
+		return pool
+	}
+	pool := newNodePool(addr)
+	if cc.isClosed() {
+		// a reload finishing after Close must not dial the nodes
+		pool.Close()
+	}
+	if cc.RedisClient != nil {
+		pool.hooks = cc.hooks
+		pool.logger = cc.logger
+		pool.breaker = newCircuitBreaker(cc.breakerOpts, pool)
+	}
+	cc.nodes[addr] = pool
+	return pool
+}
+
+// knownAddrs returns the masters of the slot map followed by the seed addresses
+func (cc *ClusterClient) knownAddrs() []string {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, shard := range cc.slots {
+		if shard != nil && !seen[shard.master] {
+			seen[shard.master] = true
+			addrs = append(addrs, shard.master)
+		}
+	}
+	for _, addr := range cc.seeds {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// onAnyNode runs cmd on the first reachable node
+func (cc *ClusterClient) onAnyNode(cmd []string) (*Reply, error) {
+	var lastErr error
+	for _, addr := range cc.knownAddrs() {
+		if cc.isClosed() {
+			return nil, ErrPoolClosed
+		}
+		reply, err := execute(cc.nodePool(addr), cmd)
+		if err == nil {
+			return reply, nil
+		}
+		if _, ok := err.(RedisError); ok {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// loadSlots reloads the slot map with CLUSTER SHARDS, or CLUSTER SLOTS before redis 7
+func (cc *ClusterClient) loadSlots() error {
+	var slots [ClusterSlots]*clusterShard
+	reply, err := cc.onAnyNode([]string{"CLUSTER", "SHARDS"})
+	if err == nil {
+		err = parseClusterShards(reply, &slots)
+	} else if _, ok := err.(RedisError); ok {
+		if reply, err = cc.onAnyNode([]string{"CLUSTER", "SLOTS"}); err == nil {
+			err = parseClusterSlots(reply, &slots)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	cc.mu.Lock()
+	cc.slots = slots
+	cc.mu.Unlock()
+	return nil
+}
+
+// reloadSlots reloads the slot map in the background, unless a reload is already in progress
+func (cc *ClusterClient) reloadSlots() {
+	if !atomic.CompareAndSwapInt32(&cc.reloading, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&cc.reloading, 0)
+		if !cc.isClosed() {
+			cc.loadSlots()
+		}
+	}()
+}
+
+// isClosed tells whether Close has been called
+func (cc *ClusterClient) isClosed() bool {
+	select {
+	case <-cc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseClusterSlots decodes CLUSTER SLOTS: arrays of the first and last slot of a range,
+// followed by the master and the replicas, each an array of ip, port and id
+func parseClusterSlots(reply *Reply, slots *[ClusterSlots]*clusterShard) error {
+	for _, r := range reply.arrayVal {
+		if len(r.arrayVal) < 3 {
+			return errors.New("malformed CLUSTER SLOTS reply")
+		}
+		shard := &clusterShard{}
+		for i, node := range r.arrayVal[2:] {
+			if len(node.arrayVal) < 2 {
+				return errors.New("malformed CLUSTER SLOTS reply")
+			}
+			addr := net.JoinHostPort(string(node.arrayVal[0].stringVal), strconv.FormatInt(node.arrayVal[1].integerVal, 10))
+			if i == 0 {
+				shard.master = addr
+			} else {
+				shard.replicas = append(shard.replicas, addr)
+			}
+		}
+		if err := assignSlots(slots, r.arrayVal[0].integerVal, r.arrayVal[1].integerVal, shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseClusterShards decodes CLUSTER SHARDS: maps with the slot ranges as a flat array of first and last slots,
+// and the nodes as maps of their properties
+func parseClusterShards(reply *Reply, slots *[ClusterSlots]*clusterShard) error {
+	for _, r := range reply.arrayVal {
+		m := r.mapVal()
+		shard := &clusterShard{}
+		if nodes, ok := m["nodes"]; ok {
+			for _, node := range nodes.arrayVal {
+				nm := node.mapVal()
+				if h, ok := nm["health"]; ok && string(h.stringVal) != "online" {
+					continue
+				}
+				host := ""
+				for _, k := range []string{"endpoint", "ip"} {
+					if v, ok := nm[k]; ok && len(v.stringVal) > 0 && string(v.stringVal) != "?" {
+						host = string(v.stringVal)
+						break
+					}
+				}
+				port, ok := nm["port"]
+				if host == "" || !ok {
+					continue
+				}
+				addr := net.JoinHostPort(host, strconv.FormatInt(port.integerVal, 10))
+				if role, ok := nm["role"]; ok && string(role.stringVal) == "master" {
+					shard.master = addr
+				} else {
+					shard.replicas = append(shard.replicas, addr)
+				}
+			}
+		}
+		if shard.master == "" {
+			continue
+		}
+		if ranges, ok := m["slots"]; ok {
+			for i := 0; i+1 < len(ranges.arrayVal); i += 2 {
+				if err := assignSlots(slots, ranges.arrayVal[i].integerVal, ranges.arrayVal[i+1].integerVal, shard); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func assignSlots(slots *[ClusterSlots]*clusterShard, first, last int64, shard *clusterShard) error {
+	if first < 0 || last >= ClusterSlots || first > last {
+		return errors.New("invalid slot range " + strconv.FormatInt(first, 10) + "-" + strconv.FormatInt(last, 10))
+	}
+	for i := first; i <= last; i++ {
+		slots[i] = shard
+	}
+	return nil
+}
+
+// masterAddr returns the address of the master serving slot, or of any node if the slot is not served
+func (cc *ClusterClient) masterAddr(slot int) string {
+	cc.mu.RLock()
+	shard := cc.slots[slot]
+	cc.mu.RUnlock()
+	if shard != nil {
+		return shard.master
+	}
+	return cc.knownAddrs()[0]
+}
+
+// moveSlot records that slot is served by the master at addr, until the slot map is reloaded
+func (cc *ClusterClient) moveSlot(slot int, addr string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if shard := cc.slots[slot]; shard == nil || shard.master != addr {
+		cc.slots[slot] = &clusterShard{master: addr}
+	}
+}
+
+// firstKey returns the first key of cmd, from the key positions of commands when it is described,
+// false if it has none
+func firstKey(cmd []string, commands map[string]*CommandInfo) (string, bool) {
+	name := strings.ToLower(cmd[0])
+	pos := 1
+	switch name {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		// script and numkeys come before the keys
+		if len(cmd) > 3 && cmd[2] != "0" {
+			return cmd[3], true
+		}
+		return "", false
+	case "xread", "xreadgroup":
+		for i, arg := range cmd {
+			if strings.EqualFold(arg, "STREAMS") && i+1 < len(cmd) {
+				return cmd[i+1], true
+			}
+		}
+		return "", false
+	case "object", "memory", "xinfo", "xgroup":
+		// container commands, the key follows the subcommand
+		pos = 2
+	default:
+		if ci, ok := commands[name]; ok {
+			pos = int(ci.FirstKey)
+		}
+	}
+	if pos <= 0 || pos >= len(cmd) {
+		return "", false
+	}
+	return cmd[pos], true
+}
+
+// redirection parses a MOVED or ASK error, e.g. "MOVED 3999 127.0.0.1:6381"
+func redirection(err RedisError) (kind string, slot int, addr string, ok bool) {
+	fields := strings.Fields(string(err))
+	if len(fields) != 3 || fields[0] != "MOVED" && fields[0] != "ASK" {
+		return "", 0, "", false
+	}
+	slot, convErr := strconv.Atoi(fields[1])
+	if convErr != nil {
+		return "", 0, "", false
+	}
+	return fields[0], slot, fields[2], true
+}
+
+// notSent tells whether err happened before the command was written: a failed dial or an open circuit breaker
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return err == ErrCircuitOpen || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// process sends cmd to the master serving the slot of its first key, following redirections,
+// and to the new master of the slot after a network error
+func (cc *ClusterClient) process(cmd []string) (*Reply, error) {
+	key, hasKey := firstKey(cmd, cc.commands)
+	if !hasKey {
+		return cc.onAnyNode(cmd)
+	}
+	slot := ClusterSlot(key)
+	if cc.replicas != nil && isReadOnly(cmd, cc.commands) {
+		cc.mu.RLock()
+		shard := cc.slots[slot]
+		cc.mu.RUnlock()
+		if shard != nil {
+			reply, err := cc.replicas.do(shard.replicas, cmd)
+			if err != errNoReplica {
+				return reply, err
+			}
+		}
+	}
+	addr := cc.masterAddr(slot)
+	asking := false
+	backoff := clusterRetryBackoff
+	var err error
+	for attempt := 0; attempt <= cc.maxRedirects; attempt++ {
+		var reply *Reply
+		reply, err = cc.do(cc.nodePool(addr), cmd, asking)
+		if err == nil {
+			return reply, nil
+		}
+		asking = false
+		rerr, ok := err.(RedisError)
+		if ok {
+			if kind, slot, target, ok := redirection(rerr); ok {
+				addr = target
+				if kind == "ASK" {
+					asking = true
+				} else {
+					cc.moveSlot(slot, target)
+					cc.reloadSlots()
+				}
+				continue
+			}
+		}
+		switch {
+		case !ok:
+			// the master may have failed, a replica promoted in its place is found by reloading the slot map.
+			// The command is sent again unless it may have been run already.
+			cc.reloadSlots()
+			if !notSent(err) && !cc.isIdempotent(cmd) {
+				return nil, err
+			}
+		case strings.HasPrefix(string(rerr), "TRYAGAIN"):
+		case strings.HasPrefix(string(rerr), "CLUSTERDOWN"):
+			cc.reloadSlots()
+		default:
+			return nil, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		addr = cc.masterAddr(ClusterSlot(key))
+	}
+	return nil, err
+}
+
+// do sends cmd on a connection of pool, preceded by ASKING when asking is true
+func (cc *ClusterClient) do(pool *ConnPool, cmd []string, asking bool) (*Reply, error) {
+	if !asking {
+		return execute(pool, cmd)
+	}
+	c, err := pool.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SendBulkCommand([][]string{{"ASKING"}, cmd}); err != nil {
+		pool.putConn(c, err)
+		return nil, err
+	}
+	_, askingErr := c.ReadResp()
+	if _, ok := askingErr.(RedisError); askingErr != nil && !ok {
+		pool.putConn(c, askingErr)
+		return nil, askingErr
+	}
+	reply, err := c.ReadResp()
+	pool.putConn(c, err)
+	if askingErr != nil && err == nil {
+		return nil, askingErr
+	}
+	return reply, err
+}
+
+// Close closes the connections to every node and stops the slot map reloads
+func (cc *ClusterClient) Close() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if !cc.isClosed() {
+		close(cc.done)
+	}
+	for _, pool := range cc.nodes {
+		pool.Close()
+	}
+	if cc.replicas != nil {
+		cc.replicas.close()
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// ClusterPipeline is a pipeline of a Redis Cluster: the commands are grouped by the node serving
+// the slot of their first key, and the groups are sent to their nodes in parallel
+type ClusterPipeline struct {
+	cc   *ClusterClient
+	cmds []*Cmd
+}
+
+// Pipeline returns a new cluster pipeline, connections are only taken from the node pools by Exec
+func (cc *ClusterClient) Pipeline() (*ClusterPipeline, error) {
+	return &ClusterPipeline{cc: cc}, nil
+}
+
+// AddCommand queues one command in the pipeline
+// returns the Cmd holding the result of the command after Exec
+func (cp *ClusterPipeline) AddCommand(command string, args ...string) *Cmd {
+	cmd := newCmd(command, args...)
+	cp.cmds = append(cp.cmds, cmd)
+	return cmd
+}
+
+// Exec sends the queued commands
+// returns the commands, in the order they were added, with their results filled in,
+// and the first error of a command, if any.
+// Commands redirected with MOVED or ASK, or failing with TRYAGAIN or CLUSTERDOWN, are retried one by one.
+func (cp *ClusterPipeline) Exec() ([]*Cmd, error) {
+	cmds := cp.cmds
+	cp.cmds = nil
+	if len(cp.cc.hooks) == 0 {
+		return cp.exec(cmds)
+	}
+	var res []*Cmd
+	err := processCmds(cp.cc.hooks, cmds, func() error {
+		var err error
+		res, err = cp.exec(cmds)
+		return err
+	})
+	return res, err
+}
+
+func (cp *ClusterPipeline) exec(cmds []*Cmd) ([]*Cmd, error) {
+	groups := make(map[string][]*Cmd)
+	// keyless commands are sent to any node
+	var anyAddr string
+	for _, cmd := range cmds {
+		var addr string
+		if key, ok := firstKey(cmd.args, cp.cc.commands); ok {
+			addr = cp.cc.masterAddr(ClusterSlot(key))
+		} else {
+			if anyAddr == "" {
+				anyAddr = cp.cc.knownAddrs()[0]
+			}
+			addr = anyAddr
+		}
+		groups[addr] = append(groups[addr], cmd)
+	}
+	var wg sync.WaitGroup
+	for addr, group := range groups {
+		wg.Add(1)
+		go func(pool *ConnPool, group []*Cmd) {
+			defer wg.Done()
+			execCmds(pool, group)
+		}(cp.cc.nodePool(addr), group)
+	}
+	wg.Wait()
+	var firstErr error
+	for _, cmd := range cmds {
+		if rerr, ok := cmd.err.(RedisError); ok && isClusterRetryable(rerr) {
+			cmd.err = nil
+			reply, err := cp.cc.process(cmd.args)
+			if err != nil {
+				cmd.err = err
+			} else {
+				cmd.setReply(reply)
+			}
+		}
+		if cmd.err != nil && firstErr == nil {
+			firstErr = cmd.err
+		}
+	}
+	return cmds, firstErr
+}
+
+// Close releases the pipeline, it holds no connection between calls of Exec
+func (cp *ClusterPipeline) Close() {}
+
+// execCmds sends cmds on one connection of pool and fills in their results,
+// a connection failure is the error of every command without a result
+func execCmds(pool *ConnPool, cmds []*Cmd) {
+	setErr := func(cmds []*Cmd, err error) {
+		for _, cmd := range cmds {
+			cmd.err = err
+		}
+	}
+	c, err := pool.GetConn()
+	if err != nil {
+		setErr(cmds, err)
+		return
+	}
+	bulkCmd := make([][]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		bulkCmd = append(bulkCmd, cmd.args)
+	}
+	if err := c.SendBulkCommand(bulkCmd); err != nil {
+		pool.putConn(c, err)
+		setErr(cmds, err)
+		return
+	}
+	for i, cmd := range cmds {
+		reply, err := c.ReadResp()
+		if err != nil {
+			if _, ok := err.(RedisError); !ok {
+				pool.putConn(c, err)
+				setErr(cmds[i:], err)
+				return
+			}
+			cmd.err = err
+			continue
+		}
+		cmd.setReply(reply)
+	}
+	pool.putConn(c, nil)
+}
+
+// isClusterRetryable tells whether a command failing with err has to be sent again, to another node or later
+func isClusterRetryable(err RedisError) bool {
+	if _, _, _, ok := redirection(err); ok {
+		return true
+	}
+	return strings.HasPrefix(string(err), "TRYAGAIN") || strings.HasPrefix(string(err), "CLUSTERDOWN")
+}
+
+// slotGroups groups the indexes of keys by hash slot, in the order of their first key
+func slotGroups(keys []string) [][]int {
+	var groups [][]int
+	bySlot := make(map[int]int)
+	for i, key := range keys {
+		slot := ClusterSlot(key)
+		g, ok := bySlot[slot]
+		if !ok {
+			g = len(groups)
+			bySlot[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// perSlot runs command once per hash slot of keys, with the keys of the slot, through a cluster pipeline
+// returns the commands in the order of the groups of slotGroups
+func (cc *ClusterClient) perSlot(command string, keys []string) ([][]int, []*Cmd, error) {
+	groups := slotGroups(keys)
+	p, _ := cc.Pipeline()
+	for _, g := range groups {
+		args := make([]string, 0, len(g))
+		for _, i := range g {
+			args = append(args, keys[i])
+		}
+		p.AddCommand(command, args...)
+	}
+	cmds, err := p.Exec()
+	return groups, cmds, err
+}
+
+// sumPerSlot runs command per hash slot of keys and sums the integer replies
+func (cc *ClusterClient) sumPerSlot(command string, keys []string) (int64, error) {
+	_, cmds, err := cc.perSlot(command, keys)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.reply.integerVal
+	}
+	return n, nil
+}
+
+// Mget returns the values of all specified keys, which may be on different nodes.
+// For every key that does not hold a string value or does not exist, the special value nil is returned.
+func (cc *ClusterClient) Mget(keys ...string) ([][]byte, error) {
+	groups, cmds, err := cc.perSlot("MGET", keys)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(keys))
+	for gi, g := range groups {
+		values := cmds[gi].reply.arrayVal
+		for j, i := range g {
+			if j < len(values) {
+				res[i] = values[j].stringVal
+			}
+		}
+	}
+	return res, nil
+}
+
+// Mset sets the given keys to their respective values, with one MSET per hash slot:
+// unlike on a single node the keys of different slots are not set atomically
+func (cc *ClusterClient) Mset(kvs map[string]string) error {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	p, _ := cc.Pipeline()
+	for _, g := range slotGroups(keys) {
+		args := make([]string, 0, 2*len(g))
+		for _, i := range g {
+			args = append(args, keys[i], kvs[keys[i]])
+		}
+		p.AddCommand("MSET", args...)
+	}
+	_, err := p.Exec()
+	return err
+}
+
+// Del removes the specified keys, which may be on different nodes. A key is ignored if it does not exist.
+func (cc *ClusterClient) Del(keys ...string) (int64, error) {
+	return cc.sumPerSlot("DEL", keys)
+}
+
+// Exists returns the number of keys existing among the given ones, a key given twice is counted twice
+func (cc *ClusterClient) Exists(keys ...string) (int64, error) {
+	return cc.sumPerSlot("EXISTS", keys)
+}
+
+// Unlink removes the specified keys like Del, reclaiming their memory in another thread
+func (cc *ClusterClient) Unlink(keys ...string) (int64, error) {
+	return cc.sumPerSlot("UNLINK", keys)
+}
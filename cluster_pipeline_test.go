@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestClusterPipeline(t *testing.T) {
+	// each node replies with the keys suffixed with its name, and redirects the keys of slot 0 to the other node
+	var addrs [2]string
+	newNode := func(name string, first, last int, other *string) string {
+		var host, port string
+		host, port = newFakeServer(t, func(cmd []string) string {
+			switch cmd[0] {
+			case "CLUSTER":
+				if cmd[1] == "SHARDS" {
+					return "-ERR unknown subcommand\r\n"
+				}
+				var b strings.Builder
+				b.WriteString("*2\r\n")
+				for i, addr := range addrs {
+					h, p, _ := net.SplitHostPort(addr)
+					fmt.Fprintf(&b, "*3\r\n:%d\r\n:%d\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n", i*8192, i*8192+8191, len(h), h, p)
+				}
+				return b.String()
+			case "COMMAND":
+				return "*0\r\n"
+			case "DEL":
+				return fmt.Sprintf(":%d\r\n", len(cmd)-1)
+			}
+			var values []string
+			for _, key := range cmd[1:] {
+				if slot := ClusterSlot(key); slot < first || slot > last {
+					return fmt.Sprintf("-MOVED %d %s\r\n", slot, *other)
+				}
+				values = append(values, key+"@"+name)
+			}
+			if cmd[0] == "GET" {
+				return fmt.Sprintf("$%d\r\n%s\r\n", len(values[0]), values[0])
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "*%d\r\n", len(values))
+			for _, v := range values {
+				fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(v), v)
+			}
+			return b.String()
+		})
+		return net.JoinHostPort(host, port)
+	}
+	addrs[0] = newNode("a", 0, 8191, &addrs[1])
+	addrs[1] = newNode("b", 8192, 16383, &addrs[0])
+	client, err := NewClusterClient([]string{addrs[0]})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+
+	p, _ := client.Pipeline()
+	foo := p.AddCommand("GET", "foo")
+	bar := p.AddCommand("GET", "bar")
+	if _, err := p.Exec(); err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if v, _ := foo.Text(); v != "foo@b" {
+		t.Errorf("test failed, expected: %s, got: %s", "foo@b", v)
+	}
+	if v, _ := bar.Text(); v != "bar@a" {
+		t.Errorf("test failed, expected: %s, got: %s", "bar@a", v)
+	}
+
+	res, err := client.Mget("foo", "bar", "{foo}x")
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	expected := "[foo@b bar@a {foo}x@b]"
+	if fmt.Sprintf("%s", res) != expected {
+		t.Errorf("test failed, expected: %s, got: %s", expected, res)
+	}
+	if n, err := client.Del("foo", "bar", "{foo}x"); err != nil || n != 3 {
+		t.Errorf("test failed, expected: 3, got: %d (%v)", n, err)
+	}
+}
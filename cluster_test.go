@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClusterSlot(t *testing.T) {
+	if crc16("123456789") != 0x31C3 {
+		t.Errorf("test failed, expected: %d, got: %d", 0x31C3, crc16("123456789"))
+	}
+	if ClusterSlot("foo") != 12182 {
+		t.Errorf("test failed, expected: %d, got: %d", 12182, ClusterSlot("foo"))
+	}
+	if ClusterSlot("{user1000}.following") != ClusterSlot("{user1000}.followers") {
+		t.Errorf("test failed, expected the same slot for keys sharing a hash tag")
+	}
+	if ClusterSlot("foo{}{bar}") != int(crc16("foo{}{bar}"))%ClusterSlots {
+		t.Errorf("test failed, expected an empty hash tag to be ignored")
+	}
+}
+
+func TestClusterClient(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	hostB, portB := newFakeServer(t, func(cmd []string) string {
+		mu.Lock()
+		received = append(received, strings.Join(cmd, " "))
+		mu.Unlock()
+		return "$1\r\nb\r\n"
+	})
+	addrB := net.JoinHostPort(hostB, portB)
+	var tryAgain int32
+	// the handler of the node returns its own port in the slot map
+	var hostA, portA string
+	hostA, portA = newFakeServer(t, func(cmd []string) string {
+		switch strings.Join(cmd, " ") {
+		case "CLUSTER SHARDS", "COMMAND":
+			return "-ERR unknown subcommand\r\n"
+		case "CLUSTER SLOTS":
+			return fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$9\r\n127.0.0.1\r\n:%s\r\n", portA)
+		case "GET foo":
+			return fmt.Sprintf("-MOVED 12182 %s\r\n", addrB)
+		case "GET bar":
+			return fmt.Sprintf("-ASK 5061 %s\r\n", addrB)
+		case "GET baz":
+			if atomic.AddInt32(&tryAgain, 1) == 1 {
+				return "-TRYAGAIN Multiple keys request during rehashing of slot\r\n"
+			}
+		}
+		return "$1\r\na\r\n"
+	})
+	client, err := NewClusterClient([]string{"127.0.0.1:1", net.JoinHostPort(hostA, portA)})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	tables := []struct {
+		key      string
+		expected string
+	}{
+		{"foo", "b"},
+		{"bar", "b"},
+		{"baz", "a"},
+		{"qux", "a"},
+	}
+	for _, table := range tables {
+		val, err := client.Get(table.key)
+		if err != nil || string(val) != table.expected {
+			t.Errorf("test failed, expected: %s, got: %s (%v)", table.expected, val, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected := "[GET foo ASKING GET bar]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, received)
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	// slots encodes a CLUSTER SLOTS reply of one master serving every slot
+	slots := func(port string) string {
+		return fmt.Sprintf("*1\r\n*3\r\n:0\r\n:16383\r\n*2\r\n$9\r\n127.0.0.1\r\n:%s\r\n", port)
+	}
+	var hostB, portB string
+	hostB, portB = newFakeServer(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "CLUSTER":
+			if cmd[1] == "SLOTS" {
+				return slots(portB)
+			}
+			return "-ERR unknown subcommand\r\n"
+		}
+		return "$1\r\nb\r\n"
+	})
+	var down int32
+	var portA string
+	_, portA = newFakeServer(t, func(cmd []string) string {
+		if atomic.LoadInt32(&down) == 1 {
+			return ""
+		}
+		switch cmd[0] {
+		case "CLUSTER":
+			if cmd[1] == "SLOTS" {
+				return slots(portA)
+			}
+			return "-ERR unknown subcommand\r\n"
+		case "COMMAND":
+			return "-ERR unknown command\r\n"
+		}
+		return "$1\r\na\r\n"
+	})
+	client, err := NewClusterClient([]string{"127.0.0.1:" + portA, net.JoinHostPort(hostB, portB)})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if val, err := client.Get("foo"); err != nil || string(val) != "a" {
+		t.Errorf("test failed, expected: a, got: %s (%v)", val, err)
+	}
+
+	// the master fails: a read is sent again to the master of the reloaded slot map
+	atomic.StoreInt32(&down, 1)
+	if val, err := client.Get("foo"); err != nil || string(val) != "b" {
+		t.Errorf("test failed, expected: b, got: %s (%v)", val, err)
+	}
+	// a write is only sent again when it was not sent before
+	if notSent(io.EOF) || !notSent(ErrCircuitOpen) {
+		t.Errorf("test failed, expected only the errors before sending to be retried")
+	}
+
+	// the pools of the nodes met after Close are closed
+	client.Close()
+	if _, err := client.nodePool("127.0.0.1:1").GetConn(); err != ErrPoolClosed {
+		t.Errorf("test failed, expected: %s, got: %v", ErrPoolClosed, err)
+	}
+	if _, err := client.onAnyNode([]string{"PING"}); err != ErrPoolClosed {
+		t.Errorf("test failed, expected: %s, got: %v", ErrPoolClosed, err)
+	}
+}
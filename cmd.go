@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Cmd is a queued command, its result is available once the command has been executed
+type Cmd struct {
+	args  []string
+	reply *Reply
+	err   error
+}
+
+func newCmd(command string, args ...string) *Cmd {
+	return &Cmd{args: append([]string{command}, args...)}
+}
+
+// Args returns the command name and its arguments
+func (c *Cmd) Args() []string {
+	return c.args
+}
+
+// Err returns the error of the command, including error replies sent by the server
+func (c *Cmd) Err() error {
+	return c.err
+}
+
+// Reply returns the raw reply of the command
+func (c *Cmd) Reply() (*Reply, error) {
+	return c.reply, c.err
+}
+
+// Bytes returns the reply as a string value, nil for a nil reply
+func (c *Cmd) Bytes() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.reply.stringVal, nil
+}
+
+// Text returns the reply as a string
+func (c *Cmd) Text() (string, error) {
+	b, err := c.Bytes()
+	return string(b), err
+}
+
+// Int64 returns the reply as an integer,
+// bulk strings holding a number are converted as well
+func (c *Cmd) Int64() (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.reply.stringVal != nil {
+		return strconv.ParseInt(string(c.reply.stringVal), 10, 64)
+	}
+	return c.reply.integerVal, nil
+}
+
+// Float64 returns the reply as a floating point number
+func (c *Cmd) Float64() (float64, error) {
+	b, err := c.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, errors.New("nil reply")
+	}
+	return strconv.ParseFloat(string(b), 64)
+}
+
+// Array returns the elements of an array reply
+func (c *Cmd) Array() ([]*Reply, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.reply.arrayVal, nil
+}
+
+func (c *Cmd) setReply(reply *Reply) {
+	c.reply = reply
+	if reply != nil && reply.errorVal != nil {
+		c.err = reply.errorVal
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"errors"
-	"fmt"
+	"log/slog"
 	"net"
 	"sync"
 	"time"
@@ -14,6 +14,8 @@ type Conn struct {
 	conn       net.Conn
 	respReader *RESPReader
 	respWriter *RESPWriter
+	// generation of the pool address the connection was dialed to
+	generation int
 }
 
 func (c *Conn) isStale(connLifeTime time.Duration) bool {
@@ -51,6 +53,11 @@ func (c *Conn) SendBulkCommand(bulkCmd [][]string) error {
 	return nil
 }
 
+// setReadDeadline makes pending and future reads fail once t is reached, the zero value disables it
+func (c *Conn) setReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
 func (c *Conn) close() {
 	c.conn.Close()
 }
@@ -67,9 +74,25 @@ type ConnPool struct {
 	idleList *stack
 	// 连接的生命周期
 	connLifeTime time.Duration
-	mu           sync.Mutex
+	// incremented every time the pool is pointed at another address
+	generation int
+	// commands sent on every new connection, e.g. READONLY on cluster replicas
+	initCmds [][]string
+	// called around the dials
+	hooks []Hook
+	// logs the dials and the evictions
+	logger *slog.Logger
+	// fails fast while the server is unreachable, nil when the client has no circuit breaker
+	breaker *circuitBreaker
+	// SHA1 digests of the scripts known to be in the scripts cache of the server, from the transactions
+	scripts map[string]bool
+	closed  bool
+	mu      sync.Mutex
 }
 
+// ErrPoolClosed is returned by GetConn once the pool is closed
+var ErrPoolClosed = errors.New("pool closed")
+
 type stack struct {
 	storage []Conn
 	top     int
@@ -120,50 +143,253 @@ func NewConnPool(host, port string, maxOpen int) *ConnPool {
 		// sets the maximum number of open connections to the database
 		maxOpen:      maxOpen,
 		connLifeTime: 5 * time.Minute,
+		logger:       discardLogger,
 	}
 }
 
 // GetConn returns a redis connection, returns error when no free conn is available
+// or ErrCircuitOpen when the circuit breaker of the pool is open
 func (cp *ConnPool) GetConn() (Conn, error) {
+	if cp.breaker == nil {
+		return cp.getConn()
+	}
+	if err := cp.breaker.allow(); err != nil {
+		return Conn{}, err
+	}
+	c, err := cp.getConn()
+	if isNetworkError(err) {
+		cp.breaker.record(err)
+	}
+	return c, err
+}
+
+func (cp *ConnPool) getConn() (Conn, error) {
 	cp.mu.Lock()
-	defer cp.mu.Unlock()
+	if cp.closed {
+		cp.mu.Unlock()
+		return Conn{}, ErrPoolClosed
+	}
+	addr := net.JoinHostPort(cp.host, cp.port)
 	// has idle connection
 	if cp.idleList.length() > 0 {
 		conn := cp.idleList.pop()
-		if conn.isStale(cp.connLifeTime) {
-			conn.close()
-			return cp.connect()
+		if !conn.isStale(cp.connLifeTime) {
+			cp.inUseCnt++
+			cp.mu.Unlock()
+			return conn, nil
 		}
-		cp.inUseCnt++
-		return conn, nil
-	}
-	// has reached max open connnection
-	if cp.inUseCnt >= cp.maxOpen {
+		defer cp.evict(conn, addr, "stale")
+	} else if cp.inUseCnt >= cp.maxOpen {
+		// has reached max open connnection
+		cp.mu.Unlock()
 		return Conn{}, errors.New("exhausted pool")
 	}
-	// no idle connnection but hasn't reach max open connection
+	// no usable idle connnection but hasn't reach max open connection:
+	// the slot is reserved and the connection dialed without the lock, the hooks may use the pool
 	cp.inUseCnt++
-	return cp.connect()
+	generation := cp.generation
+	cp.mu.Unlock()
+	conn, err := cp.connect(addr, generation)
+	if err != nil {
+		cp.mu.Lock()
+		cp.inUseCnt--
+		cp.mu.Unlock()
+		return Conn{}, err
+	}
+	return conn, nil
 }
 
-func (cp *ConnPool) connect() (Conn, error) {
-	address := fmt.Sprintf("%s:%s", cp.host, cp.port)
-	conn, err := net.Dial("tcp", address)
+// connect dials a connection to addr, the address of the pool at generation, and sends the init commands
+func (cp *ConnPool) connect(addr string, generation int) (Conn, error) {
+	netConn, err := dialWithHooks(cp.hooks, addr, 0)
 	if err != nil {
+		cp.logger.Warn("redis dial failed", "addr", addr, "err", err)
 		return Conn{}, err
 	}
+	cp.logger.Debug("redis connection dialed", "addr", addr)
+	conn := newConn(netConn)
+	conn.generation = generation
+	for _, cmd := range cp.initCmds {
+		err := conn.SendCommand(cmd...)
+		if err == nil {
+			_, err = conn.ReadResp()
+		}
+		if err != nil {
+			conn.close()
+			return Conn{}, err
+		}
+	}
+	return conn, nil
+}
+
+func dialConn(address string, timeout time.Duration) (Conn, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return Conn{}, err
+	}
+	return newConn(conn), nil
+}
+
+func newConn(conn net.Conn) Conn {
 	return Conn{
 		createTime: time.Now(),
 		conn:       conn,
 		respReader: NewRESPReader(conn),
-		respWriter: NewRESPWriter(conn)}, nil
+		respWriter: NewRESPWriter(conn)}
 }
 
 // ReleaseConn put a connection back into pool
+// a connection to a previous address of the pool, or released after Close, is closed instead
 func (cp *ConnPool) ReleaseConn(c Conn) {
 	cp.mu.Lock()
-	defer cp.mu.Unlock()
+	cp.inUseCnt--
+	if cp.closed {
+		cp.mu.Unlock()
+		c.close()
+		return
+	}
+	if c.generation != cp.generation {
+		addr := net.JoinHostPort(cp.host, cp.port)
+		cp.mu.Unlock()
+		cp.evict(c, addr, "address changed")
+		return
+	}
 	cp.idleList.push(c)
+	cp.mu.Unlock()
+}
+
+// RemoveConn closes a connection taken from the pool instead of putting it back,
+// used when the connection is broken or left in a state the next user must not inherit
+func (cp *ConnPool) RemoveConn(c Conn) {
+	cp.mu.Lock()
 	cp.inUseCnt--
-	return
+	addr := net.JoinHostPort(cp.host, cp.port)
+	cp.mu.Unlock()
+	cp.evict(c, addr, "removed")
+}
+
+// putConn puts back a connection after a command failed by err, or closes it when err left it broken:
+// a network error or a malformed reply leaves unread bytes or no stream at all
+func (cp *ConnPool) putConn(c Conn, err error) {
+	if cp.breaker != nil {
+		if isNetworkError(err) {
+			cp.breaker.record(err)
+		} else {
+			cp.breaker.record(nil)
+		}
+	}
+	if _, ok := err.(RedisError); err != nil && !ok {
+		cp.RemoveConn(c)
+		return
+	}
+	cp.ReleaseConn(c)
+}
+
+// ping dials a new connection to send a PING within timeout, an error reply such as NOAUTH means the server is up
+func (cp *ConnPool) ping(timeout time.Duration) error {
+	netConn, err := dialWithHooks(cp.hooks, cp.addr(), timeout)
+	if err != nil {
+		return err
+	}
+	c := newConn(netConn)
+	defer c.close()
+	if err := c.setReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if err := c.SendCommand("PING"); err != nil {
+		return err
+	}
+	_, err = c.ReadResp()
+	if _, ok := err.(RedisError); ok {
+		return nil
+	}
+	return err
+}
+
+// evict closes a connection to addr which is not reused, the lock must not be held
+func (cp *ConnPool) evict(c Conn, addr, reason string) {
+	c.close()
+	cp.logger.Debug("redis connection evicted", "addr", addr, "reason", reason)
+}
+
+// setAddr points the pool at another address, the idle connections are closed
+// and the ones in use are closed when they are released
+func (cp *ConnPool) setAddr(host, port string) {
+	cp.mu.Lock()
+	if cp.host == host && cp.port == port {
+		cp.mu.Unlock()
+		return
+	}
+	oldAddr := net.JoinHostPort(cp.host, cp.port)
+	cp.host = host
+	cp.port = port
+	cp.generation++
+	// the scripts cache of the new server may be empty
+	cp.scripts = nil
+	var idle []Conn
+	for cp.idleList.length() > 0 {
+		idle = append(idle, cp.idleList.pop())
+	}
+	cp.mu.Unlock()
+	for _, c := range idle {
+		cp.evict(c, oldAddr, "address changed")
+	}
+	// the failures were those of the previous server
+	if cp.breaker != nil {
+		cp.breaker.reset()
+	}
+}
+
+func (cp *ConnPool) addr() string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return net.JoinHostPort(cp.host, cp.port)
+}
+
+func (cp *ConnPool) closeIdle() {
+	for cp.idleList.length() > 0 {
+		c := cp.idleList.pop()
+		c.close()
+	}
+}
+
+// scriptCached tells whether the script with SHA1 digest hash is known to be in the scripts cache of the server
+func (cp *ConnPool) scriptCached(hash string) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.scripts[hash]
+}
+
+func (cp *ConnPool) setScriptCached(hash string, cached bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.scripts == nil {
+		cp.scripts = make(map[string]bool)
+	}
+	cp.scripts[hash] = cached
+}
+
+// PoolStats is the state of a ConnPool
+type PoolStats struct {
+	Idle    int
+	InUse   int
+	MaxOpen int
+}
+
+// Stats returns the state of the pool
+func (cp *ConnPool) Stats() PoolStats {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return PoolStats{Idle: cp.idleList.length(), InUse: cp.inUseCnt, MaxOpen: cp.maxOpen}
+}
+
+// Close closes the idle connections, the ones in use are closed when they are released
+func (cp *ConnPool) Close() {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.closed = true
+	cp.closeIdle()
+	if cp.breaker != nil {
+		cp.breaker.stop()
+	}
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestPush(t *testing.T) {
@@ -38,3 +41,62 @@ func TestConnPool(t *testing.T) {
 		t.Errorf("test failed, expected nil, got: %s", err)
 	}
 }
+
+// statsHook reads the stats of the pool while a connection is dialed
+type statsHook struct {
+	client *RedisClient
+	stats  []PoolStats
+}
+
+func (h *statsHook) BeforeProcess(ctx context.Context, cmd []string) (context.Context, []string, error) {
+	return ctx, cmd, nil
+}
+
+func (h *statsHook) AfterProcess(ctx context.Context, cmd []string, err error) error {
+	return err
+}
+
+func (h *statsHook) BeforeProcessPipeline(ctx context.Context, cmds [][]string) (context.Context, [][]string, error) {
+	return ctx, cmds, nil
+}
+
+func (h *statsHook) AfterProcessPipeline(ctx context.Context, cmds [][]string, err error) error {
+	return err
+}
+
+func (h *statsHook) BeforeDial(ctx context.Context, network, addr string) (context.Context, error) {
+	h.stats = append(h.stats, h.client.PoolStats())
+	return ctx, nil
+}
+
+func (h *statsHook) AfterDial(ctx context.Context, network, addr string, conn net.Conn, err error) (net.Conn, error) {
+	return conn, err
+}
+
+func TestDialOutsidePoolLock(t *testing.T) {
+	hook := &statsHook{}
+	client := newFakeClient(t, func(cmd []string) string {
+		return "+OK\r\n"
+	}, WithHooks(hook))
+	hook.client = client
+	done := make(chan error)
+	go func() {
+		_, err := client.Set("k", "v")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("test failed, expected nil, got: %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("test failed, the dial hook deadlocked on the pool")
+	}
+	// the slot of the connection being dialed is reserved
+	if len(hook.stats) != 1 || hook.stats[0].InUse != 1 {
+		t.Errorf("test failed, expected: 1 connection in use, got: %+v", hook.stats)
+	}
+	if stats := client.PoolStats(); stats.InUse != 0 || stats.Idle != 1 {
+		t.Errorf("test failed, expected: 1 idle connection, got: %+v", stats)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// FunctionLibrary describes a library of functions loaded on the server
+type FunctionLibrary struct {
+	Name      string
+	Engine    string
+	Functions []FunctionInfo
+	// Code is only filled when listed with code
+	Code string
+}
+
+// FunctionInfo describes one function of a library
+type FunctionInfo struct {
+	Name        string
+	Description string
+	Flags       []string
+}
+
+// FunctionStats is the result of FUNCTION STATS
+type FunctionStats struct {
+	// RunningScript is the name of the function currently running, empty when idle
+	RunningScript string
+	// RunningCommand is the command and arguments of the running function
+	RunningCommand []string
+	// RunningDuration is how long the function has been running, in milliseconds
+	RunningDuration int64
+	// Engines maps each engine to its number of libraries and functions
+	Engines map[string]FunctionEngineStats
+}
+
+// FunctionEngineStats counts the libraries and functions of one engine
+type FunctionEngineStats struct {
+	Libraries int64
+	Functions int64
+}
+
+// FunctionLoad loads a library into the server, replacing an existing library with the same name if replace is true
+// returns the name of the library
+func (rc *RedisClient) FunctionLoad(code string, replace bool) (string, error) {
+	args := []string{"LOAD"}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	reply, err := rc.executeCommand("FUNCTION", append(args, code)...)
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// FunctionList returns the libraries whose name matches pattern, every library if pattern is empty,
+// with their code if withCode is true
+func (rc *RedisClient) FunctionList(pattern string, withCode bool) ([]FunctionLibrary, error) {
+	args := []string{"LIST"}
+	if pattern != "" {
+		args = append(args, "LIBRARYNAME", pattern)
+	}
+	if withCode {
+		args = append(args, "WITHCODE")
+	}
+	reply, err := rc.executeCommand("FUNCTION", args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]FunctionLibrary, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		m := r.mapVal()
+		lib := FunctionLibrary{}
+		if v, ok := m["library_name"]; ok {
+			lib.Name = string(v.stringVal)
+		}
+		if v, ok := m["engine"]; ok {
+			lib.Engine = string(v.stringVal)
+		}
+		if v, ok := m["library_code"]; ok {
+			lib.Code = string(v.stringVal)
+		}
+		if v, ok := m["functions"]; ok {
+			for _, f := range v.arrayVal {
+				fm := f.mapVal()
+				info := FunctionInfo{}
+				if name, ok := fm["name"]; ok {
+					info.Name = string(name.stringVal)
+				}
+				if desc, ok := fm["description"]; ok {
+					info.Description = string(desc.stringVal)
+				}
+				if flags, ok := fm["flags"]; ok {
+					for _, flag := range flags.arrayVal {
+						info.Flags = append(info.Flags, string(flag.stringVal))
+					}
+				}
+				lib.Functions = append(lib.Functions, info)
+			}
+		}
+		res = append(res, lib)
+	}
+	return res, nil
+}
+
+// FunctionDelete deletes a library and all its functions
+func (rc *RedisClient) FunctionDelete(library string) error {
+	_, err := rc.executeCommand("FUNCTION", "DELETE", library)
+	return err
+}
+
+// FunctionFlush deletes all the libraries, asynchronously if async is true
+func (rc *RedisClient) FunctionFlush(async bool) error {
+	_, err := rc.executeCommand("FUNCTION", append([]string{"FLUSH"}, flushArgs(async)...)...)
+	return err
+}
+
+// FunctionDump returns a serialized payload of all the libraries, to be restored with FunctionRestore
+func (rc *RedisClient) FunctionDump() ([]byte, error) {
+	reply, err := rc.executeCommand("FUNCTION", "DUMP")
+	if err != nil {
+		return nil, err
+	}
+	return reply.stringVal, nil
+}
+
+// FunctionRestore restores the libraries of a payload returned by FunctionDump
+// policy is APPEND, REPLACE or FLUSH, APPEND being the default when it is empty
+func (rc *RedisClient) FunctionRestore(payload []byte, policy string) error {
+	args := []string{"RESTORE", string(payload)}
+	if policy != "" {
+		args = append(args, policy)
+	}
+	_, err := rc.executeCommand("FUNCTION", args...)
+	return err
+}
+
+// FunctionStats returns information about the running function and the loaded engines
+func (rc *RedisClient) FunctionStats() (*FunctionStats, error) {
+	reply, err := rc.executeCommand("FUNCTION", "STATS")
+	if err != nil {
+		return nil, err
+	}
+	m := reply.mapVal()
+	res := &FunctionStats{Engines: make(map[string]FunctionEngineStats)}
+	if v, ok := m["running_script"]; ok && v.arrayVal != nil {
+		script := v.mapVal()
+		if name, ok := script["name"]; ok {
+			res.RunningScript = string(name.stringVal)
+		}
+		if cmd, ok := script["command"]; ok {
+			for _, arg := range cmd.arrayVal {
+				res.RunningCommand = append(res.RunningCommand, string(arg.stringVal))
+			}
+		}
+		if d, ok := script["duration_ms"]; ok {
+			res.RunningDuration = d.integerVal
+		}
+	}
+	if v, ok := m["engines"]; ok {
+		for name, e := range v.mapVal() {
+			em := e.mapVal()
+			stats := FunctionEngineStats{}
+			if n, ok := em["libraries_count"]; ok {
+				stats.Libraries = n.integerVal
+			}
+			if n, ok := em["functions_count"]; ok {
+				stats.Functions = n.integerVal
+			}
+			res.Engines[name] = stats
+		}
+	}
+	return res, nil
+}
+
+// FCall invokes a function, keys are passed to the function as keys and args as its arguments
+func (rc *RedisClient) FCall(function string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("FCALL", evalArgs(function, keys, args)...)
+}
+
+// FCallRO is the read-only variant of FCall, the function must be flagged no-writes
+func (rc *RedisClient) FCallRO(function string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("FCALL_RO", evalArgs(function, keys, args)...)
+}
+
+// libraryName returns the library name declared by the shebang of a library, e.g. #!lua name=mylib
+func libraryName(code string) (string, error) {
+	line := code
+	if i := strings.IndexByte(code, '\n'); i >= 0 {
+		line = code[:i]
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return "", errors.New("library code does not start with a shebang")
+	}
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "name=") {
+			return strings.TrimPrefix(field, "name="), nil
+		}
+	}
+	return "", errors.New("library shebang does not declare a name")
+}
+
+// LoadFunctionLibrary deploys the library stored in path of fsys, typically an embed.FS,
+// unless the server already runs the same code, then checks that the deployed code matches it
+// returns the name of the library
+func (rc *RedisClient) LoadFunctionLibrary(fsys fs.FS, path string) (string, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return "", err
+	}
+	code := string(b)
+	name, err := libraryName(code)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	deployed, err := rc.deployedLibraryCode(name)
+	if err != nil {
+		return "", err
+	}
+	if deployed == code {
+		return name, nil
+	}
+	if _, err := rc.FunctionLoad(code, true); err != nil {
+		return "", err
+	}
+	// another client may deploy a different version concurrently
+	deployed, err = rc.deployedLibraryCode(name)
+	if err != nil {
+		return "", err
+	}
+	if deployed != code {
+		return "", fmt.Errorf("library %s deployed on the server does not match %s", name, path)
+	}
+	return name, nil
+}
+
+// deployedLibraryCode returns the code of a library loaded on the server, empty if it is not loaded
+func (rc *RedisClient) deployedLibraryCode(name string) (string, error) {
+	libs, err := rc.FunctionList(name, true)
+	if err != nil {
+		return "", err
+	}
+	for _, lib := range libs {
+		// the name is used as a pattern by the server
+		if lib.Name == name {
+			return lib.Code, nil
+		}
+	}
+	return "", nil
+}
+
+// WithFunctionLibrary makes NewRedisClient deploy the library stored in path of fsys with LoadFunctionLibrary,
+// failing if it can not be deployed
+func WithFunctionLibrary(fsys fs.FS, path string) Option {
+	return func(rc *RedisClient) {
+		rc.onStart = append(rc.onStart, func() error {
+			_, err := rc.LoadFunctionLibrary(fsys, path)
+			return err
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLibraryName(t *testing.T) {
+	name, err := libraryName("#!lua name=ratelimit\nredis.register_function('hit', function(keys, args) return 1 end)")
+	if err != nil || name != "ratelimit" {
+		t.Errorf("test failed, expected: ratelimit, got: %s (%v)", name, err)
+	}
+	if _, err := libraryName("redis.register_function('hit', function() end)"); err == nil {
+		t.Errorf("test failed, expected not nil, got: nil")
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	loaded := ""
+	client := newFakeClient(t, func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		// only the first line of the code of a library is recorded
+		received = append(received, strings.SplitN(strings.Join(cmd, " "), "\n", 2)[0])
+		switch strings.Join(cmd[:2], " ") {
+		case "FUNCTION LOAD":
+			loaded = cmd[len(cmd)-1]
+			return bulk("ratelimit")
+		case "FUNCTION LIST":
+			if loaded == "" {
+				return "*0\r\n"
+			}
+			return "*1\r\n*8\r\n" + bulk("library_name") + bulk("ratelimit") + bulk("engine") + bulk("LUA") +
+				bulk("functions") + "*1\r\n*6\r\n" + bulk("name") + bulk("hit") + bulk("description") + "$-1\r\n" +
+				bulk("flags") + "*1\r\n" + bulk("no-writes") +
+				bulk("library_code") + bulk(loaded)
+		case "FUNCTION STATS":
+			return "*4\r\n" + bulk("running_script") + "*6\r\n" + bulk("name") + bulk("hit") +
+				bulk("command") + "*3\r\n" + bulk("fcall") + bulk("hit") + bulk("0") + bulk("duration_ms") + ":5\r\n" +
+				bulk("engines") + "*2\r\n" + bulk("LUA") + "*4\r\n" + bulk("libraries_count") + ":1\r\n" +
+				bulk("functions_count") + ":2\r\n"
+		}
+		return ":1\r\n"
+	})
+
+	code := "#!lua name=ratelimit\nredis.register_function('hit', function(keys, args) return 1 end)"
+	fsys := fstest.MapFS{"ratelimit.lua": &fstest.MapFile{Data: []byte(code)}}
+	for i := 0; i < 2; i++ {
+		// the second call finds the library deployed and does not load it again
+		if name, err := client.LoadFunctionLibrary(fsys, "ratelimit.lua"); err != nil || name != "ratelimit" {
+			t.Errorf("test failed, expected: ratelimit, got: %s (%v)", name, err)
+		}
+	}
+
+	libs, err := client.FunctionList("ratelimit", false)
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	expectedLibs := "[{Name:ratelimit Engine:LUA Functions:[{Name:hit Description: Flags:[no-writes]}] Code:" + code + "}]"
+	if fmt.Sprintf("%+v", libs) != expectedLibs {
+		t.Errorf("test failed, expected: %s, got: %+v", expectedLibs, libs)
+	}
+
+	stats, err := client.FunctionStats()
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	expectedStats := "&{RunningScript:hit RunningCommand:[fcall hit 0] RunningDuration:5 Engines:map[LUA:{Libraries:1 Functions:2}]}"
+	if fmt.Sprintf("%+v", stats) != expectedStats {
+		t.Errorf("test failed, expected: %s, got: %+v", expectedStats, stats)
+	}
+
+	if reply, err := client.FCall("hit", []string{"k"}, "10"); err != nil || reply.integerVal != 1 {
+		t.Errorf("test failed, expected: 1, got: %v (%v)", reply, err)
+	}
+	client.FCallRO("hit", []string{"k"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"FUNCTION LIST LIBRARYNAME ratelimit WITHCODE",
+		"FUNCTION LOAD REPLACE #!lua name=ratelimit",
+		"FUNCTION LIST LIBRARYNAME ratelimit WITHCODE",
+		"FUNCTION LIST LIBRARYNAME ratelimit WITHCODE",
+		"FUNCTION LIST LIBRARYNAME ratelimit",
+		"FUNCTION STATS",
+		"FCALL hit 1 k 10",
+		"FCALL_RO hit 1 k",
+	}
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("test failed, expected: %q, got: %q", expected, received)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// GeoUnit is the unit of distances of the geo commands
+type GeoUnit string
+
+// units of distances
+const (
+	GeoMeters     GeoUnit = "m"
+	GeoKilometers GeoUnit = "km"
+	GeoMiles      GeoUnit = "mi"
+	GeoFeet       GeoUnit = "ft"
+)
+
+// GeoLocation is a member of a geospatial index
+type GeoLocation struct {
+	Name      string
+	Longitude float64
+	Latitude  float64
+	// Dist is the distance from the center of a search, filled by GeoSearch with WithDist
+	Dist float64
+	// GeoHash is the raw geohash score, filled by GeoSearch with WithHash
+	GeoHash int64
+}
+
+// GeoAddArgs are the options of GEOADD
+type GeoAddArgs struct {
+	// NX only adds new members, XX only updates existing ones
+	NX bool
+	XX bool
+	// CH counts the changed members in the result, not only the added ones
+	CH bool
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// GeoAdd adds locations to the geospatial index stored at key
+// returns the number of members added, or changed with CH
+func (rc *RedisClient) GeoAdd(key string, ga GeoAddArgs, locations ...GeoLocation) (int64, error) {
+	args := []string{key}
+	if ga.NX {
+		args = append(args, "NX")
+	}
+	if ga.XX {
+		args = append(args, "XX")
+	}
+	if ga.CH {
+		args = append(args, "CH")
+	}
+	for _, l := range locations {
+		args = append(args, formatFloat(l.Longitude), formatFloat(l.Latitude), l.Name)
+	}
+	reply, err := rc.executeCommand("GEOADD", args...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// GeoPos returns the positions of members, nil for the members which do not exist
+func (rc *RedisClient) GeoPos(key string, members ...string) ([]*GeoLocation, error) {
+	reply, err := rc.executeCommand("GEOPOS", append([]string{key}, members...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*GeoLocation, len(reply.arrayVal))
+	for i, r := range reply.arrayVal {
+		if len(r.arrayVal) != 2 {
+			continue
+		}
+		l := &GeoLocation{}
+		if i < len(members) {
+			l.Name = members[i]
+		}
+		if err := parseCoord(r, l); err != nil {
+			return nil, err
+		}
+		res[i] = l
+	}
+	return res, nil
+}
+
+func parseCoord(r *Reply, l *GeoLocation) error {
+	if len(r.arrayVal) != 2 {
+		return errors.New("malformed coordinates")
+	}
+	var err error
+	if l.Longitude, err = strconv.ParseFloat(string(r.arrayVal[0].stringVal), 64); err != nil {
+		return err
+	}
+	l.Latitude, err = strconv.ParseFloat(string(r.arrayVal[1].stringVal), 64)
+	return err
+}
+
+// GeoDist returns the distance between two members in unit, meters if it is empty
+// returns an error if one of the members does not exist
+func (rc *RedisClient) GeoDist(key, member1, member2 string, unit GeoUnit) (float64, error) {
+	args := []string{key, member1, member2}
+	if unit != "" {
+		args = append(args, string(unit))
+	}
+	reply, err := rc.executeCommand("GEODIST", args...)
+	if err != nil {
+		return 0, err
+	}
+	if reply.stringVal == nil {
+		return 0, errors.New("member does not exist")
+	}
+	return strconv.ParseFloat(string(reply.stringVal), 64)
+}
+
+// GeoHash returns the geohash strings of members, empty for the members which do not exist
+func (rc *RedisClient) GeoHash(key string, members ...string) ([]string, error) {
+	reply, err := rc.executeCommand("GEOHASH", append([]string{key}, members...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		res = append(res, string(r.stringVal))
+	}
+	return res, nil
+}
+
+// GeoSearchQuery describes the area searched by GeoSearch and GeoSearchStore
+type GeoSearchQuery struct {
+	// Member is the center of the search, FROMMEMBER, when it is not empty
+	Member string
+	// Longitude and Latitude are the center of the search, FROMLONLAT, when Member is empty
+	Longitude float64
+	Latitude  float64
+	// Radius searches a circle, BYRADIUS, when it is positive
+	Radius float64
+	// Width and Height search a box, BYBOX, when Radius is zero
+	Width  float64
+	Height float64
+	// Unit of Radius, Width and Height, meters by default
+	Unit GeoUnit
+	// Sort is ASC or DESC to sort by distance from the center
+	Sort string
+	// Count limits the number of results when positive, Any returns as soon as enough matches are found
+	Count int64
+	Any   bool
+	// WithCoord, WithDist and WithHash fill the corresponding fields of the results
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+}
+
+func (q *GeoSearchQuery) args() []string {
+	var args []string
+	if q.Member != "" {
+		args = append(args, "FROMMEMBER", q.Member)
+	} else {
+		args = append(args, "FROMLONLAT", formatFloat(q.Longitude), formatFloat(q.Latitude))
+	}
+	unit := q.Unit
+	if unit == "" {
+		unit = GeoMeters
+	}
+	if q.Radius > 0 {
+		args = append(args, "BYRADIUS", formatFloat(q.Radius), string(unit))
+	} else {
+		args = append(args, "BYBOX", formatFloat(q.Width), formatFloat(q.Height), string(unit))
+	}
+	if q.Sort != "" {
+		args = append(args, q.Sort)
+	}
+	if q.Count > 0 {
+		args = append(args, "COUNT", strconv.FormatInt(q.Count, 10))
+		if q.Any {
+			args = append(args, "ANY")
+		}
+	}
+	return args
+}
+
+// GeoSearch returns the members of the geospatial index stored at key within the area of q
+func (rc *RedisClient) GeoSearch(key string, q GeoSearchQuery) ([]GeoLocation, error) {
+	args := append([]string{key}, q.args()...)
+	if q.WithCoord {
+		args = append(args, "WITHCOORD")
+	}
+	if q.WithDist {
+		args = append(args, "WITHDIST")
+	}
+	if q.WithHash {
+		args = append(args, "WITHHASH")
+	}
+	reply, err := rc.executeCommand("GEOSEARCH", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseGeoSearch(reply, q)
+}
+
+// parseGeoSearch decodes the results of GEOSEARCH, which are arrays of the name followed by
+// the distance, the hash and the coordinates, in this order, when they are requested
+func parseGeoSearch(reply *Reply, q GeoSearchQuery) ([]GeoLocation, error) {
+	res := make([]GeoLocation, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		if r.arrayVal == nil {
+			res = append(res, GeoLocation{Name: string(r.stringVal)})
+			continue
+		}
+		fields := r.arrayVal
+		if len(fields) == 0 {
+			return nil, errors.New("malformed GEOSEARCH reply")
+		}
+		l := GeoLocation{Name: string(fields[0].stringVal)}
+		fields = fields[1:]
+		if q.WithDist && len(fields) > 0 {
+			dist, err := strconv.ParseFloat(string(fields[0].stringVal), 64)
+			if err != nil {
+				return nil, err
+			}
+			l.Dist = dist
+			fields = fields[1:]
+		}
+		if q.WithHash && len(fields) > 0 {
+			l.GeoHash = fields[0].integerVal
+			fields = fields[1:]
+		}
+		if q.WithCoord && len(fields) > 0 {
+			if err := parseCoord(fields[0], &l); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// GeoSearchStore stores the members found like GeoSearch in the geospatial index dest,
+// or their distances in the sorted set dest when storeDist is true
+// returns the number of stored members
+func (rc *RedisClient) GeoSearchStore(key, dest string, q GeoSearchQuery, storeDist bool) (int64, error) {
+	args := append([]string{dest, key}, q.args()...)
+	if storeDist {
+		args = append(args, "STOREDIST")
+	}
+	reply, err := rc.executeCommand("GEOSEARCHSTORE", args...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
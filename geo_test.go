@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseGeoSearch(t *testing.T) {
+	b := bytes.NewBufferString("*1\r\n*4\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n:3479099956230698\r\n*2\r\n$18\r\n13.361389338970184\r\n$16\r\n38.1155563954963\r\n")
+	reply, _ := NewRESPReader(b).ReadResp()
+	res, err := parseGeoSearch(reply, GeoSearchQuery{WithCoord: true, WithDist: true, WithHash: true})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	expected := GeoLocation{Name: "Palermo", Longitude: 13.361389338970184, Latitude: 38.1155563954963, Dist: 190.4424, GeoHash: 3479099956230698}
+	if len(res) != 1 || res[0] != expected {
+		t.Errorf("test failed, expected: %v, got: %v", expected, res)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestConn returns a connection to a fake server which sends resp, whatever it receives
+func newTestConn(resp string) Conn {
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, server)
+	go server.Write([]byte(resp))
+	return Conn{
+		createTime: time.Now(),
+		conn:       client,
+		respReader: NewRESPReader(client),
+		respWriter: NewRESPWriter(client),
+	}
+}
+
+// newFakeServer starts a server answering every command it receives with handle, which returns raw RESP,
+// or an empty string to close the connection
+// returns the host and port of the server
+func newFakeServer(t *testing.T, handle func(cmd []string) string) (string, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := NewRESPReader(c)
+				for {
+					reply, err := r.ReadResp()
+					if err != nil {
+						return
+					}
+					var cmd []string
+					for _, arg := range reply.arrayVal {
+						cmd = append(cmd, string(arg.stringVal))
+					}
+					// an empty reply closes the connection
+					resp := handle(cmd)
+					if resp == "" {
+						return
+					}
+					if _, err := io.WriteString(c, resp); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return host, port
+}
+
+// bulk encodes s as a RESP bulk string
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// newFakeClient returns a client of a fake server answering with handle, closed at the end of the test
+func newFakeClient(t *testing.T, handle func(cmd []string) string, opts ...Option) *RedisClient {
+	host, port := newFakeServer(t, handle)
+	client, err := NewRedisClient(host, port, opts...)
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
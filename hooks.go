@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Hook is called around the commands, the pipelines and the dials of a client.
+// The hooks run in the order they were added before the operation, and in the reverse order after it.
+// Every method of a hook gets the context returned by the Before methods of the previous hooks,
+// e.g. to carry a span from BeforeProcess to AfterProcess.
+//
+// The arguments only use standard types so that a hook can be written in another package.
+type Hook interface {
+	// BeforeProcess is called before a command is sent, cmd being its name followed by its arguments
+	// returns the command to send, which may be modified.
+	// An error fails the command without sending it, a *ShortCircuit error answers it with its reply.
+	BeforeProcess(ctx context.Context, cmd []string) (context.Context, []string, error)
+	// AfterProcess is called once the command has returned, or has been failed by a later hook
+	// returns the error of the command, which may be replaced
+	AfterProcess(ctx context.Context, cmd []string, err error) error
+	// BeforeProcessPipeline and AfterProcessPipeline are the equivalents of BeforeProcess and AfterProcess
+	// for the commands of a pipeline, a pipelined transaction, a cluster or a ring pipeline
+	BeforeProcessPipeline(ctx context.Context, cmds [][]string) (context.Context, [][]string, error)
+	AfterProcessPipeline(ctx context.Context, cmds [][]string, err error) error
+	// BeforeDial is called before a connection is dialed to addr, an error fails the dial
+	BeforeDial(ctx context.Context, network, addr string) (context.Context, error)
+	// AfterDial is called once the dial has returned
+	// returns the connection to use, which may be wrapped, and the error of the dial, which may be replaced
+	AfterDial(ctx context.Context, network, addr string, conn net.Conn, err error) (net.Conn, error)
+}
+
+// ShortCircuit is returned by Hook.BeforeProcess to answer a command without sending it to the server,
+// the command then returns Reply and Err.
+// Returned by Hook.BeforeProcessPipeline, it fails the pipeline with Err.
+type ShortCircuit struct {
+	Reply *Reply
+	Err   error
+}
+
+func (sc *ShortCircuit) Error() string {
+	if sc.Err != nil {
+		return "short-circuited: " + sc.Err.Error()
+	}
+	return "short-circuited"
+}
+
+// WithHooks adds hooks around the commands, the pipelines and the dials of the client
+func WithHooks(hooks ...Hook) Option {
+	return func(rc *RedisClient) {
+		rc.hooks = append(rc.hooks, hooks...)
+	}
+}
+
+// processWithHooks runs cmd through the hooks of the client
+func (rc *RedisClient) processWithHooks(ctx context.Context, cmd []string) (*Reply, error) {
+	var err error
+	// the number of hooks whose BeforeProcess succeeded, only they get AfterProcess
+	n := 0
+	for _, h := range rc.hooks {
+		hctx, hcmd, herr := h.BeforeProcess(ctx, cmd)
+		if herr != nil {
+			err = herr
+			break
+		}
+		ctx, cmd = hctx, hcmd
+		n++
+	}
+	var reply *Reply
+	var sc *ShortCircuit
+	switch {
+	case err == nil:
+		reply, err = rc.processWithRetry(cmd)
+	case errors.As(err, &sc):
+		reply, err = sc.Reply, sc.Err
+	}
+	for i := n - 1; i >= 0; i-- {
+		err = rc.hooks[i].AfterProcess(ctx, cmd, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// processPipeline runs the commands of a pipeline through hooks, exec sends them
+func processPipeline(hooks []Hook, cmds [][]string, exec func(cmds [][]string) error) error {
+	ctx := context.Background()
+	var err error
+	n := 0
+	for _, h := range hooks {
+		hctx, hcmds, herr := h.BeforeProcessPipeline(ctx, cmds)
+		if herr != nil {
+			err = herr
+			break
+		}
+		ctx, cmds = hctx, hcmds
+		n++
+	}
+	var sc *ShortCircuit
+	switch {
+	case err == nil:
+		err = exec(cmds)
+	case errors.As(err, &sc):
+		err = sc.Err
+	}
+	for i := n - 1; i >= 0; i-- {
+		err = hooks[i].AfterProcessPipeline(ctx, cmds, err)
+	}
+	return err
+}
+
+// processCmds runs queued commands through hooks, the hooks may modify their arguments but not their number
+func processCmds(hooks []Hook, cmds []*Cmd, exec func() error) error {
+	args := make([][]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		args = append(args, cmd.args)
+	}
+	return processPipeline(hooks, args, func(args [][]string) error {
+		if len(args) != len(cmds) {
+			return errors.New("a pipeline hook changed the number of commands")
+		}
+		for i, cmd := range cmds {
+			cmd.args = args[i]
+		}
+		return exec()
+	})
+}
+
+// dialWithHooks dials addr through hooks, giving up after timeout unless it is 0
+func dialWithHooks(hooks []Hook, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx := context.Background()
+	var err error
+	n := 0
+	for _, h := range hooks {
+		hctx, herr := h.BeforeDial(ctx, "tcp", addr)
+		if herr != nil {
+			err = herr
+			break
+		}
+		ctx = hctx
+		n++
+	}
+	var conn net.Conn
+	if err == nil {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	for i := n - 1; i >= 0; i-- {
+		conn, err = hooks[i].AfterDial(ctx, "tcp", addr, conn, err)
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cs50Mu/redigo/instrumentation"
+)
+
+// testHook prefixes the keys of the commands, answers GET cached from memory and counts the dials
+type testHook struct {
+	calls []string
+	dials int
+}
+
+func (h *testHook) BeforeProcess(ctx context.Context, cmd []string) (context.Context, []string, error) {
+	h.calls = append(h.calls, "before "+strings.Join(cmd, " "))
+	if cmd[0] == "GET" && cmd[1] == "cached" {
+		return ctx, cmd, &ShortCircuit{Reply: &Reply{stringVal: []byte("from hook")}}
+	}
+	return context.WithValue(ctx, h, "span"), append([]string{cmd[0], "ns:" + cmd[1]}, cmd[2:]...), nil
+}
+
+func (h *testHook) AfterProcess(ctx context.Context, cmd []string, err error) error {
+	h.calls = append(h.calls, fmt.Sprintf("after %s %v %v", strings.Join(cmd, " "), ctx.Value(h), err))
+	return err
+}
+
+func (h *testHook) BeforeProcessPipeline(ctx context.Context, cmds [][]string) (context.Context, [][]string, error) {
+	h.calls = append(h.calls, fmt.Sprintf("before pipeline %d", len(cmds)))
+	return ctx, cmds, nil
+}
+
+func (h *testHook) AfterProcessPipeline(ctx context.Context, cmds [][]string, err error) error {
+	h.calls = append(h.calls, fmt.Sprintf("after pipeline %v", err))
+	return err
+}
+
+func (h *testHook) BeforeDial(ctx context.Context, network, addr string) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *testHook) AfterDial(ctx context.Context, network, addr string, conn net.Conn, err error) (net.Conn, error) {
+	h.dials++
+	return conn, err
+}
+
+func TestHooks(t *testing.T) {
+	hook := &testHook{}
+	client := newFakeClient(t, func(cmd []string) string {
+		s := strings.Join(cmd, " ")
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+	}, WithHooks(hook))
+	if val, _ := client.Get("k"); string(val) != "GET ns:k" {
+		t.Errorf("test failed, expected: %s, got: %s", "GET ns:k", val)
+	}
+	// the hook answering the command does not get AfterProcess, only the hooks before it do
+	if val, _ := client.Get("cached"); string(val) != "from hook" {
+		t.Errorf("test failed, expected: %s, got: %s", "from hook", val)
+	}
+	p, _ := client.Pipeline()
+	p.AddCommand("GET", "a")
+	p.AddCommand("GET", "b")
+	if _, err := p.Exec(); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	p.Close()
+	expected := "[before GET k after GET ns:k span <nil> before GET cached before pipeline 2 after pipeline <nil>]"
+	if fmt.Sprint(hook.calls) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, hook.calls)
+	}
+	if hook.dials != 1 {
+		t.Errorf("test failed, expected: 1, got: %d", hook.dials)
+	}
+}
+
+func TestInstrumentationHook(t *testing.T) {
+	tracer := &instrumentation.InMemoryTracer{}
+	meter := &instrumentation.InMemoryMeter{}
+	host, port := newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "INCR" {
+			return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		}
+		return "+OK\r\n"
+	})
+	hook := instrumentation.NewHook(instrumentation.Config{Tracer: tracer, Meter: meter, Addr: net.JoinHostPort(host, port)})
+	client, err := NewRedisClient(host, port, WithHooks(hook))
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	client.Set("k", "secret")
+	client.Incr("k")
+	p, _ := client.Pipeline()
+	p.AddCommand("SET", "a", "1")
+	p.AddCommand("GET", "a")
+	p.Exec()
+	p.Close()
+
+	var names []string
+	spans := make(map[string]instrumentation.SpanData)
+	for _, span := range tracer.Spans() {
+		names = append(names, span.Name)
+		spans[span.Name] = span
+		if !span.Ended {
+			t.Errorf("test failed, expected the %s span to be ended", span.Name)
+		}
+	}
+	// the dial of the connection happens within the span of the first command
+	if expected := "[SET DIAL INCR PIPELINE]"; fmt.Sprint(names) != expected {
+		t.Fatalf("test failed, expected: %s, got: %v", expected, names)
+	}
+	portNum, _ := strconv.Atoi(port)
+	expected := map[string]interface{}{
+		"db.system":     "redis",
+		"db.operation":  "SET",
+		"db.statement":  "SET k ?",
+		"net.peer.name": "127.0.0.1",
+		"net.peer.port": portNum,
+	}
+	for k, v := range expected {
+		if spans["SET"].Attributes[k] != v {
+			t.Errorf("test failed, expected: %s %v, got: %v", k, v, spans["SET"].Attributes[k])
+		}
+	}
+	if spans["INCR"].Err == nil {
+		t.Errorf("test failed, expected: WRONGTYPE, got: nil")
+	}
+	if pipeline := spans["PIPELINE"]; pipeline.Attributes["db.redis.num_cmd"] != 2 || pipeline.Attributes["db.statement"] != "SET a ?\nGET a" {
+		t.Errorf("test failed, expected: PIPELINE of 2 commands, got: %+v", pipeline.Attributes)
+	}
+
+	var operations []string
+	for _, m := range meter.Histogram("db.client.operation.duration") {
+		operations = append(operations, fmt.Sprintf("%v %v", m.Attributes["db.operation"], m.Attributes["error.type"]))
+		if m.Value <= 0 {
+			t.Errorf("test failed, expected a positive duration, got: %v", m.Value)
+		}
+	}
+	if expected := "[SET <nil> INCR WRONGTYPE PIPELINE <nil>]"; fmt.Sprint(operations) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, operations)
+	}
+}
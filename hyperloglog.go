@@ -0,0 +1,26 @@
+package main
+
+// PFAdd adds elements to the HyperLogLog stored at key
+// returns true if the approximated cardinality has changed
+func (rc *RedisClient) PFAdd(key string, elements ...string) (bool, error) {
+	reply, err := rc.executeCommand("PFADD", append([]string{key}, elements...)...)
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// PFCount returns the approximated cardinality of the union of the HyperLogLogs stored at keys
+func (rc *RedisClient) PFCount(keys ...string) (int64, error) {
+	reply, err := rc.executeCommand("PFCOUNT", keys...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// PFMerge merges the HyperLogLogs stored at sources into dest
+func (rc *RedisClient) PFMerge(dest string, sources ...string) error {
+	_, err := rc.executeCommand("PFMERGE", append([]string{dest}, sources...)...)
+	return err
+}
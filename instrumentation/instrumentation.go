@@ -0,0 +1,254 @@
+// Package instrumentation traces and measures the commands of a redigo client.
+//
+// Hook implements the Hook interface of the client, it creates a span per command, pipeline and dial,
+// and records the duration of the commands:
+//
+//	hook := instrumentation.NewHook(instrumentation.Config{Tracer: tracer, Meter: meter, Addr: "localhost:6379"})
+//	client, err := NewRedisClient("localhost", "6379", WithHooks(hook))
+//	hook.ObservePool(func() (idle, inUse, maxOpen int) {
+//		s := client.PoolStats()
+//		return s.Idle, s.InUse, s.MaxOpen
+//	})
+//
+// Tracer and Meter follow the shape of the OpenTelemetry API and use its semantic conventions,
+// so that they can be backed by the OpenTelemetry SDK with thin adapters.
+// InMemoryTracer and InMemoryMeter keep what is recorded, for tests.
+package instrumentation
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attribute is a key/value pair describing a span or a measurement
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError records err and marks the span as failed
+	RecordError(err error)
+	End()
+}
+
+// Tracer starts spans
+type Tracer interface {
+	// Start starts a span, child of the span of ctx if there is one
+	// returns a context holding the new span
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Histogram records a distribution of values
+type Histogram interface {
+	Record(ctx context.Context, value float64, attrs ...Attribute)
+}
+
+// Meter creates instruments
+type Meter interface {
+	Float64Histogram(name, unit, description string) Histogram
+	// Int64ObservableGauge registers a gauge whose values are reported by callback when metrics are collected
+	Int64ObservableGauge(name, unit, description string, callback func(observe func(value int64, attrs ...Attribute)))
+}
+
+// Config configures a Hook
+type Config struct {
+	// Tracer creates the spans, no span is created when it is nil
+	Tracer Tracer
+	// Meter creates the instruments, nothing is measured when it is nil
+	Meter Meter
+	// Addr is the host:port address of the server, reported as net.peer.name and net.peer.port
+	Addr string
+	// Statement returns the db.statement of a command, RedactedStatement by default
+	Statement func(cmd []string) string
+}
+
+// Hook creates spans and records measurements around the commands, the pipelines and the dials of a client
+type Hook struct {
+	cfg      Config
+	peer     []Attribute
+	duration Histogram
+}
+
+// NewHook returns a hook instrumenting a client as described by cfg
+func NewHook(cfg Config) *Hook {
+	if cfg.Statement == nil {
+		cfg.Statement = RedactedStatement
+	}
+	h := &Hook{cfg: cfg, peer: peerAttributes(cfg.Addr)}
+	if cfg.Meter != nil {
+		h.duration = cfg.Meter.Float64Histogram("db.client.operation.duration", "s", "Duration of the commands")
+	}
+	return h
+}
+
+func peerAttributes(addr string) []Attribute {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	attrs := []Attribute{String("net.peer.name", host)}
+	if n, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, Int("net.peer.port", n))
+	}
+	return attrs
+}
+
+// sensitiveCommands have every argument redacted, they may carry passwords
+var sensitiveCommands = map[string]bool{
+	"AUTH": true, "HELLO": true, "ACL": true, "CONFIG": true, "MIGRATE": true,
+}
+
+// RedactedStatement returns the command name followed by its first argument, usually the key,
+// the other arguments being replaced with ?
+func RedactedStatement(cmd []string) string {
+	if len(cmd) == 0 {
+		return ""
+	}
+	parts := []string{strings.ToUpper(cmd[0])}
+	for i := 1; i < len(cmd); i++ {
+		if i == 1 && !sensitiveCommands[parts[0]] {
+			parts = append(parts, cmd[i])
+		} else {
+			parts = append(parts, "?")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+type (
+	startKey struct{}
+	spanKey  struct{}
+)
+
+// start records the start time of an operation in ctx, and starts its span if there is a tracer
+func (h *Hook) start(ctx context.Context, name string, attrs ...Attribute) context.Context {
+	ctx = context.WithValue(ctx, startKey{}, time.Now())
+	if h.cfg.Tracer == nil {
+		return ctx
+	}
+	attrs = append(append([]Attribute{String("db.system", "redis")}, h.peer...), attrs...)
+	ctx, span := h.cfg.Tracer.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// end ends the span of an operation started by start and records its duration
+func (h *Hook) end(ctx context.Context, operation string, err error) {
+	endSpan(ctx, err)
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if h.duration == nil || !ok {
+		return
+	}
+	attrs := []Attribute{String("db.system", "redis"), String("db.operation", operation)}
+	if err != nil {
+		attrs = append(attrs, String("error.type", errorType(err)))
+	}
+	h.duration.Record(ctx, time.Since(start).Seconds(), attrs...)
+}
+
+func endSpan(ctx context.Context, err error) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// errorType returns the prefix of an error reply, e.g. WRONGTYPE, or "error" for the other errors
+func errorType(err error) string {
+	fields := strings.Fields(err.Error())
+	if len(fields) == 0 || strings.Trim(fields[0], "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "error"
+	}
+	return fields[0]
+}
+
+// BeforeProcess starts the span of a command, an empty command is not traced
+func (h *Hook) BeforeProcess(ctx context.Context, cmd []string) (context.Context, []string, error) {
+	if len(cmd) == 0 {
+		return ctx, cmd, nil
+	}
+	name := strings.ToUpper(cmd[0])
+	return h.start(ctx, name, String("db.operation", name), String("db.statement", h.cfg.Statement(cmd))), cmd, nil
+}
+
+// AfterProcess ends the span of a command and records its duration
+func (h *Hook) AfterProcess(ctx context.Context, cmd []string, err error) error {
+	if len(cmd) == 0 {
+		return err
+	}
+	h.end(ctx, strings.ToUpper(cmd[0]), err)
+	return err
+}
+
+// BeforeProcessPipeline starts the span of a pipeline
+func (h *Hook) BeforeProcessPipeline(ctx context.Context, cmds [][]string) (context.Context, [][]string, error) {
+	statements := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		statements = append(statements, h.cfg.Statement(cmd))
+	}
+	ctx = h.start(ctx, "PIPELINE",
+		String("db.operation", "PIPELINE"),
+		String("db.statement", strings.Join(statements, "\n")),
+		Int("db.redis.num_cmd", len(cmds)))
+	return ctx, cmds, nil
+}
+
+// AfterProcessPipeline ends the span of a pipeline and records its duration
+func (h *Hook) AfterProcessPipeline(ctx context.Context, cmds [][]string, err error) error {
+	h.end(ctx, "PIPELINE", err)
+	return err
+}
+
+// BeforeDial starts the span of a dial
+func (h *Hook) BeforeDial(ctx context.Context, network, addr string) (context.Context, error) {
+	if h.cfg.Tracer == nil {
+		return ctx, nil
+	}
+	attrs := append([]Attribute{String("db.system", "redis")}, peerAttributes(addr)...)
+	ctx, span := h.cfg.Tracer.Start(ctx, "DIAL", attrs...)
+	return context.WithValue(ctx, spanKey{}, span), nil
+}
+
+// AfterDial ends the span of a dial
+func (h *Hook) AfterDial(ctx context.Context, network, addr string, conn net.Conn, err error) (net.Conn, error) {
+	endSpan(ctx, err)
+	return conn, err
+}
+
+// ObservePool registers gauges reporting the state of a connection pool, as returned by stats:
+// db.client.connections.usage with a state attribute, idle or used, and db.client.connections.max
+func (h *Hook) ObservePool(stats func() (idle, inUse, maxOpen int)) {
+	if h.cfg.Meter == nil {
+		return
+	}
+	h.cfg.Meter.Int64ObservableGauge("db.client.connections.usage", "{connection}", "Connections of the pool by state",
+		func(observe func(int64, ...Attribute)) {
+			idle, inUse, _ := stats()
+			observe(int64(idle), String("state", "idle"))
+			observe(int64(inUse), String("state", "used"))
+		})
+	h.cfg.Meter.Int64ObservableGauge("db.client.connections.max", "{connection}", "Maximum number of open connections",
+		func(observe func(int64, ...Attribute)) {
+			_, _, maxOpen := stats()
+			observe(int64(maxOpen))
+		})
+}
@@ -0,0 +1,99 @@
+package instrumentation
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRedactedStatement(t *testing.T) {
+	tests := map[string][]string{
+		"SET k ?":        {"set", "k", "secret"},
+		"GET k":          {"GET", "k"},
+		"AUTH ? ?":       {"AUTH", "user", "password"},
+		"CONFIG ? ?":     {"config", "get", "requirepass"},
+		"PING":           {"ping"},
+		"HSET h ? ? ? ?": {"HSET", "h", "f1", "v1", "f2", "v2"},
+	}
+	for expected, cmd := range tests {
+		if s := RedactedStatement(cmd); s != expected {
+			t.Errorf("test failed, expected: %s, got: %s", expected, s)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	tracer := &InMemoryTracer{}
+	meter := &InMemoryMeter{}
+	hook := NewHook(Config{Tracer: tracer, Meter: meter, Addr: "localhost:6379"})
+
+	ctx, cmd, _ := hook.BeforeProcess(context.Background(), []string{"set", "k", "v"})
+	hook.AfterProcess(ctx, cmd, nil)
+	ctx, cmd, _ = hook.BeforeProcess(context.Background(), nil)
+	hook.AfterProcess(ctx, cmd, nil)
+	ctx, cmd, _ = hook.BeforeProcess(context.Background(), []string{"incr", "k"})
+	hook.AfterProcess(ctx, cmd, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	cmds := [][]string{{"GET", "a"}, {"GET", "b"}}
+	ctx, cmds, _ = hook.BeforeProcessPipeline(context.Background(), cmds)
+	hook.AfterProcessPipeline(ctx, cmds, nil)
+	ctx, _ = hook.BeforeDial(context.Background(), "tcp", "10.0.0.1:6380")
+	hook.AfterDial(ctx, "tcp", "10.0.0.1:6380", nil, errors.New("connection refused"))
+
+	spans := tracer.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("test failed, expected: 4, got: %d", len(spans))
+	}
+	set := spans[0]
+	if set.Name != "SET" || !set.Ended || set.Err != nil {
+		t.Errorf("test failed, expected: ended SET span, got: %+v", set)
+	}
+	expected := map[string]interface{}{
+		"db.system":     "redis",
+		"db.operation":  "SET",
+		"db.statement":  "SET k ?",
+		"net.peer.name": "localhost",
+		"net.peer.port": 6379,
+	}
+	for k, v := range expected {
+		if set.Attributes[k] != v {
+			t.Errorf("test failed, expected: %v, got: %v", v, set.Attributes[k])
+		}
+	}
+	if spans[1].Err == nil {
+		t.Errorf("test failed, expected: error, got: nil")
+	}
+	if spans[2].Name != "PIPELINE" || spans[2].Attributes["db.redis.num_cmd"] != 2 || spans[2].Attributes["db.statement"] != "GET a\nGET b" {
+		t.Errorf("test failed, expected: PIPELINE span, got: %+v", spans[2])
+	}
+	if spans[3].Name != "DIAL" || spans[3].Attributes["net.peer.name"] != "10.0.0.1" || spans[3].Err == nil || !spans[3].Ended {
+		t.Errorf("test failed, expected: failed DIAL span, got: %+v", spans[3])
+	}
+
+	durations := meter.Histogram("db.client.operation.duration")
+	if len(durations) != 3 {
+		t.Fatalf("test failed, expected: 3, got: %d", len(durations))
+	}
+	if durations[0].Attributes["db.operation"] != "SET" || durations[0].Value < 0 {
+		t.Errorf("test failed, expected: SET, got: %+v", durations[0])
+	}
+	if durations[1].Attributes["error.type"] != "WRONGTYPE" {
+		t.Errorf("test failed, expected: WRONGTYPE, got: %v", durations[1].Attributes["error.type"])
+	}
+	if durations[2].Attributes["db.operation"] != "PIPELINE" {
+		t.Errorf("test failed, expected: PIPELINE, got: %v", durations[2].Attributes["db.operation"])
+	}
+}
+
+func TestObservePool(t *testing.T) {
+	meter := &InMemoryMeter{}
+	hook := NewHook(Config{Meter: meter})
+	hook.ObservePool(func() (int, int, int) { return 3, 2, 10 })
+	usage := meter.Collect("db.client.connections.usage")
+	if len(usage) != 2 || usage[0].Value != 3 || usage[0].Attributes["state"] != "idle" ||
+		usage[1].Value != 2 || usage[1].Attributes["state"] != "used" {
+		t.Errorf("test failed, expected: idle 3 and used 2, got: %+v", usage)
+	}
+	if max := meter.Collect("db.client.connections.max"); len(max) != 1 || max[0].Value != 10 {
+		t.Errorf("test failed, expected: 10, got: %+v", max)
+	}
+}
@@ -0,0 +1,153 @@
+package instrumentation
+
+import (
+	"context"
+	"sync"
+)
+
+// SpanData is a span recorded by an InMemoryTracer
+type SpanData struct {
+	Name       string
+	Attributes map[string]interface{}
+	// Err is the last error recorded on the span
+	Err   error
+	Ended bool
+}
+
+// InMemoryTracer is a Tracer keeping the spans it starts
+type InMemoryTracer struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// Start starts a span kept by the tracer
+func (t *InMemoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &memorySpan{t: t, data: &SpanData{Name: name, Attributes: make(map[string]interface{})}}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span.data)
+	t.mu.Unlock()
+	return ctx, span
+}
+
+// Spans returns a copy of the spans started so far, in the order they were started
+func (t *InMemoryTracer) Spans() []SpanData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]SpanData, 0, len(t.spans))
+	for _, s := range t.spans {
+		span := *s
+		span.Attributes = make(map[string]interface{}, len(s.Attributes))
+		for k, v := range s.Attributes {
+			span.Attributes[k] = v
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// Reset forgets the spans started so far
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+type memorySpan struct {
+	t    *InMemoryTracer
+	data *SpanData
+}
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.data.Err = err
+}
+
+func (s *memorySpan) End() {
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	s.data.Ended = true
+}
+
+// Measurement is a value recorded by a histogram or reported by a gauge of an InMemoryMeter
+type Measurement struct {
+	Value      float64
+	Attributes map[string]interface{}
+}
+
+// InMemoryMeter is a Meter keeping the values recorded by its histograms
+// and reporting the values of its gauges on Collect
+type InMemoryMeter struct {
+	mu         sync.Mutex
+	histograms map[string][]Measurement
+	gauges     map[string]func(observe func(int64, ...Attribute))
+}
+
+// Float64Histogram returns a histogram whose values are kept under name
+func (m *InMemoryMeter) Float64Histogram(name, unit, description string) Histogram {
+	return &memoryHistogram{m: m, name: name}
+}
+
+// Int64ObservableGauge registers a gauge reported by Collect under name
+func (m *InMemoryMeter) Int64ObservableGauge(name, unit, description string, callback func(observe func(int64, ...Attribute))) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gauges == nil {
+		m.gauges = make(map[string]func(observe func(int64, ...Attribute)))
+	}
+	m.gauges[name] = callback
+}
+
+// Histogram returns the values recorded by the histogram name
+func (m *InMemoryMeter) Histogram(name string) []Measurement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Measurement(nil), m.histograms[name]...)
+}
+
+// Collect calls the callback of the gauge name
+// returns the values it reported
+func (m *InMemoryMeter) Collect(name string) []Measurement {
+	m.mu.Lock()
+	callback, ok := m.gauges[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	var res []Measurement
+	callback(func(value int64, attrs ...Attribute) {
+		res = append(res, measurement(float64(value), attrs))
+	})
+	return res
+}
+
+type memoryHistogram struct {
+	m    *InMemoryMeter
+	name string
+}
+
+func (h *memoryHistogram) Record(ctx context.Context, value float64, attrs ...Attribute) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if h.m.histograms == nil {
+		h.m.histograms = make(map[string][]Measurement)
+	}
+	h.m.histograms[h.name] = append(h.m.histograms[h.name], measurement(value, attrs))
+}
+
+func measurement(value float64, attrs []Attribute) Measurement {
+	res := Measurement{Value: value, Attributes: make(map[string]interface{}, len(attrs))}
+	for _, attr := range attrs {
+		res.Attributes[attr.Key] = attr.Value
+	}
+	return res
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// NoExpiration is returned by TTL and PTTL when the key exists but has no associated expire
+	NoExpiration time.Duration = -1
+	// KeyNotFound is returned by TTL and PTTL when the key does not exist
+	KeyNotFound time.Duration = -2
+)
+
+// ExpireCondition makes the expire commands set the timeout only under a condition, since redis 7
+type ExpireCondition string
+
+const (
+	// ExpireNX sets the expiry only when the key has no expiry
+	ExpireNX ExpireCondition = "NX"
+	// ExpireXX sets the expiry only when the key has an existing expiry
+	ExpireXX ExpireCondition = "XX"
+	// ExpireGT sets the expiry only when the new expiry is greater than the current one
+	ExpireGT ExpireCondition = "GT"
+	// ExpireLT sets the expiry only when the new expiry is less than the current one
+	ExpireLT ExpireCondition = "LT"
+)
+
+func (rc *RedisClient) expire(command, key, value string, cond []ExpireCondition) (bool, error) {
+	args := []string{key, value}
+	for _, c := range cond {
+		args = append(args, string(c))
+	}
+	reply, err := rc.executeCommand(command, args...)
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// ttlDuration converts a reply of TTL or PTTL, keeping the negative values as NoExpiration and KeyNotFound
+func ttlDuration(n int64, unit time.Duration) time.Duration {
+	switch n {
+	case -1:
+		return NoExpiration
+	case -2:
+		return KeyNotFound
+	}
+	return time.Duration(n) * unit
+}
+
+// unixTime converts a reply of EXPIRETIME or PEXPIRETIME, the zero time is returned when there is no expiry
+func unixTime(n int64, unit time.Duration) time.Time {
+	if n < 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n*int64(unit))
+}
+
+// PExpire set a timeout on key with a millisecond precision
+// return false if key does not exist, or the timeout was not set because of cond
+func (rc *RedisClient) PExpire(key string, d time.Duration, cond ...ExpireCondition) (bool, error) {
+	return rc.expire("PEXPIRE", key, strconv.FormatInt(d.Milliseconds(), 10), cond)
+}
+
+// ExpireAt sets key to expire at t, with a second precision
+// return false if key does not exist, or the timeout was not set because of cond
+func (rc *RedisClient) ExpireAt(key string, t time.Time, cond ...ExpireCondition) (bool, error) {
+	return rc.expire("EXPIREAT", key, strconv.FormatInt(t.Unix(), 10), cond)
+}
+
+// PExpireAt sets key to expire at t, with a millisecond precision
+// return false if key does not exist, or the timeout was not set because of cond
+func (rc *RedisClient) PExpireAt(key string, t time.Time, cond ...ExpireCondition) (bool, error) {
+	return rc.expire("PEXPIREAT", key, strconv.FormatInt(t.UnixMilli(), 10), cond)
+}
+
+// PTTL returns the remaining time to live of a key with a millisecond precision
+// returns NoExpiration if the key exists but has no associated expire, KeyNotFound if the key does not exist
+func (rc *RedisClient) PTTL(key string) (time.Duration, error) {
+	reply, err := rc.executeCommand("PTTL", key)
+	if err != nil {
+		return 0, err
+	}
+	return ttlDuration(reply.integerVal, time.Millisecond), nil
+}
+
+// ExpireTime returns the time at which key will expire, with a second precision
+// returns the zero time if the key has no associated expire or does not exist, TTL tells them apart
+func (rc *RedisClient) ExpireTime(key string) (time.Time, error) {
+	reply, err := rc.executeCommand("EXPIRETIME", key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return unixTime(reply.integerVal, time.Second), nil
+}
+
+// PExpireTime returns the time at which key will expire, with a millisecond precision
+// returns the zero time if the key has no associated expire or does not exist
+func (rc *RedisClient) PExpireTime(key string) (time.Time, error) {
+	reply, err := rc.executeCommand("PEXPIRETIME", key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return unixTime(reply.integerVal, time.Millisecond), nil
+}
+
+// Persist removes the existing timeout on key
+// return false if key does not exist or has no associated timeout
+func (rc *RedisClient) Persist(key string) (bool, error) {
+	reply, err := rc.executeCommand("PERSIST", key)
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// Exists returns the number of keys existing among the given ones, a key given twice is counted twice
+func (rc *RedisClient) Exists(keys ...string) (int64, error) {
+	reply, err := rc.executeCommand("EXISTS", keys...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// Unlink removes the specified keys like Del, reclaiming their memory in another thread
+func (rc *RedisClient) Unlink(keys ...string) (int64, error) {
+	reply, err := rc.executeCommand("UNLINK", keys...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// Touch alters the last access time of the given keys
+// returns the number of keys that were touched
+func (rc *RedisClient) Touch(keys ...string) (int64, error) {
+	reply, err := rc.executeCommand("TOUCH", keys...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// Type returns the type of the value stored at key: string, list, set, zset, hash, stream, or none if it does not exist
+func (rc *RedisClient) Type(key string) (string, error) {
+	reply, err := rc.executeCommand("TYPE", key)
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// Rename renames key to newKey, overwriting newKey if it exists
+func (rc *RedisClient) Rename(key, newKey string) error {
+	_, err := rc.executeCommand("RENAME", key, newKey)
+	return err
+}
+
+// RenameNX renames key to newKey if newKey does not exist yet
+// return false if newKey already exists
+func (rc *RedisClient) RenameNX(key, newKey string) (bool, error) {
+	reply, err := rc.executeCommand("RENAMENX", key, newKey)
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// Copy copies the value stored at src to dst, in the database db, or the current one if db is negative
+// return false if dst already exists and replace is false
+func (rc *RedisClient) Copy(src, dst string, db int, replace bool) (bool, error) {
+	args := []string{src, dst}
+	if db >= 0 {
+		args = append(args, "DB", strconv.Itoa(db))
+	}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	reply, err := rc.executeCommand("COPY", args...)
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// Move moves key to the database db
+// return false if key does not exist or already exists in db
+func (rc *RedisClient) Move(key string, db int) (bool, error) {
+	reply, err := rc.executeCommand("MOVE", key, strconv.Itoa(db))
+	if err != nil {
+		return false, err
+	}
+	return reply.integerVal == 1, nil
+}
+
+// Dump serializes the value stored at key, to be restored with Restore
+// returns nil if key does not exist
+func (rc *RedisClient) Dump(key string) ([]byte, error) {
+	reply, err := rc.executeCommand("DUMP", key)
+	if err != nil {
+		return nil, err
+	}
+	return reply.stringVal, nil
+}
+
+// Restore creates key from a value serialized by Dump, expiring after ttl unless it is zero
+// An existing key is replaced only if replace is true.
+func (rc *RedisClient) Restore(key string, ttl time.Duration, value []byte, replace bool) error {
+	args := []string{key, strconv.FormatInt(ttl.Milliseconds(), 10), string(value)}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	_, err := rc.executeCommand("RESTORE", args...)
+	return err
+}
+
+// ObjectEncoding returns the internal encoding of the value stored at key, e.g. listpack, hashtable, embstr
+func (rc *RedisClient) ObjectEncoding(key string) (string, error) {
+	reply, err := rc.executeCommand("OBJECT", "ENCODING", key)
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// ObjectFreq returns the logarithmic access frequency counter of key, the maxmemory-policy must be an LFU one
+func (rc *RedisClient) ObjectFreq(key string) (int64, error) {
+	reply, err := rc.executeCommand("OBJECT", "FREQ", key)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// ObjectIdleTime returns the time since key was last accessed
+func (rc *RedisClient) ObjectIdleTime(key string) (time.Duration, error) {
+	reply, err := rc.executeCommand("OBJECT", "IDLETIME", key)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(reply.integerVal) * time.Second, nil
+}
+
+// RandomKey returns a random key of the current database, or an empty string when the database is empty
+func (rc *RedisClient) RandomKey() (string, error) {
+	reply, err := rc.executeCommand("RANDOMKEY")
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// SortArgs are the options of SORT
+type SortArgs struct {
+	// By sorts by the values of external keys, e.g. weight_*, "nosort" skips sorting
+	By string
+	// Offset and Count limit the returned elements, when Count is positive
+	Offset int64
+	Count  int64
+	// Get returns the values of external keys instead of the elements, "#" being the element itself
+	Get []string
+	// Desc sorts in descending order
+	Desc bool
+	// Alpha sorts lexicographically instead of numerically
+	Alpha bool
+}
+
+func (sa SortArgs) args(key string) []string {
+	args := []string{key}
+	if sa.By != "" {
+		args = append(args, "BY", sa.By)
+	}
+	if sa.Count > 0 {
+		args = append(args, "LIMIT", strconv.FormatInt(sa.Offset, 10), strconv.FormatInt(sa.Count, 10))
+	}
+	for _, get := range sa.Get {
+		args = append(args, "GET", get)
+	}
+	if sa.Desc {
+		args = append(args, "DESC")
+	}
+	if sa.Alpha {
+		args = append(args, "ALPHA")
+	}
+	return args
+}
+
+// Sort returns the sorted elements of the list, set or sorted set stored at key
+func (rc *RedisClient) Sort(key string, sa SortArgs) ([]string, error) {
+	return rc.sort("SORT", sa.args(key))
+}
+
+// SortRO is the read-only variant of Sort
+func (rc *RedisClient) SortRO(key string, sa SortArgs) ([]string, error) {
+	return rc.sort("SORT_RO", sa.args(key))
+}
+
+func (rc *RedisClient) sort(command string, args []string) ([]string, error) {
+	reply, err := rc.executeCommand(command, args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		res = append(res, string(r.stringVal))
+	}
+	return res, nil
+}
+
+// SortStore sorts like Sort and stores the result as a list at dst
+// returns the number of elements of the list
+func (rc *RedisClient) SortStore(key, dst string, sa SortArgs) (int64, error) {
+	reply, err := rc.executeCommand("SORT", append(sa.args(key), "STORE", dst)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	ttls := map[string]string{"persistent": ":-1\r\n", "missing": ":-2\r\n", "session": ":42\r\n"}
+	client := newFakeClient(t, func(cmd []string) string {
+		return ttls[cmd[1]]
+	})
+	tables := []struct {
+		key      string
+		expected time.Duration
+	}{
+		{"persistent", NoExpiration},
+		{"missing", KeyNotFound},
+		{"session", 42 * time.Second},
+	}
+	for _, table := range tables {
+		ttl, err := client.TTL(table.key)
+		if err != nil {
+			t.Fatalf("test failed, expected nil, got: %s", err)
+		}
+		if ttl != table.expected {
+			t.Errorf("test failed, expected: %s, got: %s", table.expected, ttl)
+		}
+	}
+}
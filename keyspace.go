@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// KeyspaceEvent is a keyspace notification: an event, such as expired, evicted, set, del or hset, which happened to a key
+type KeyspaceEvent struct {
+	DB    int
+	Key   string
+	Event string
+}
+
+// KeyspaceListenerOptions configures a KeyspaceListener
+type KeyspaceListenerOptions struct {
+	// DB is the database to listen to, a negative value listens to every database
+	DB int
+	// KeyPattern filters keys with a glob-style pattern, every key by default
+	KeyPattern string
+	// Events filters the types of events, every event by default
+	Events []string
+	// NotifyConfig, when not empty, is set as notify-keyspace-events on the server before subscribing, e.g. "KEA".
+	// Notifications are disabled by default on the server.
+	NotifyConfig string
+	// Subscription configures the underlying subscription, may be nil
+	Subscription *SubscriptionOptions
+}
+
+// KeyspaceListener delivers the keyspace notifications of redis on a go channel
+type KeyspaceListener struct {
+	sub    *Subscription
+	events map[string]bool
+	ch     chan *KeyspaceEvent
+}
+
+// NewKeyspaceListener subscribes to the keyspace notifications selected by opts
+// When only event types are filtered, the listener subscribes to __keyevent@<db>__ channels, the server needs the E flag;
+// otherwise it subscribes to __keyspace@<db>__ channels and needs the K flag.
+func (rc *RedisClient) NewKeyspaceListener(ctx context.Context, opts KeyspaceListenerOptions) (*KeyspaceListener, error) {
+	if opts.NotifyConfig != "" {
+		if _, err := rc.executeCommand("CONFIG", "SET", "notify-keyspace-events", opts.NotifyConfig); err != nil {
+			return nil, err
+		}
+	}
+	db := "*"
+	if opts.DB >= 0 {
+		db = strconv.Itoa(opts.DB)
+	}
+	var patterns []string
+	kl := &KeyspaceListener{}
+	if opts.KeyPattern == "" && len(opts.Events) > 0 {
+		for _, event := range opts.Events {
+			patterns = append(patterns, "__keyevent@"+db+"__:"+event)
+		}
+	} else {
+		keyPattern := opts.KeyPattern
+		if keyPattern == "" {
+			keyPattern = "*"
+		}
+		patterns = append(patterns, "__keyspace@"+db+"__:"+keyPattern)
+		// keyspace channels carry every event of the key, they are filtered here
+		if len(opts.Events) > 0 {
+			kl.events = make(map[string]bool, len(opts.Events))
+			for _, event := range opts.Events {
+				kl.events[event] = true
+			}
+		}
+	}
+
+	ps, err := rc.PubSub()
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.PSubscribe(patterns...); err != nil {
+		ps.Close()
+		return nil, err
+	}
+	kl.sub = ps.Channel(ctx, opts.Subscription)
+	kl.ch = make(chan *KeyspaceEvent, cap(kl.sub.ch))
+	go kl.run()
+	return kl, nil
+}
+
+// C returns the channel on which events are delivered, it is closed when the listener stops
+func (kl *KeyspaceListener) C() <-chan *KeyspaceEvent {
+	return kl.ch
+}
+
+// Err returns the error which stopped the listener, nil while it is running or when it was closed normally
+func (kl *KeyspaceListener) Err() error {
+	return kl.sub.Err()
+}
+
+// Close stops the listener
+func (kl *KeyspaceListener) Close() error {
+	return kl.sub.Close()
+}
+
+func (kl *KeyspaceListener) run() {
+	defer close(kl.ch)
+	for msg := range kl.sub.C() {
+		if msg.Kind != "pmessage" {
+			continue
+		}
+		event, err := parseKeyspaceEvent(msg)
+		if err != nil {
+			continue
+		}
+		if kl.events != nil && !kl.events[event.Event] {
+			continue
+		}
+		select {
+		case kl.ch <- event:
+		case <-kl.sub.done:
+			return
+		}
+	}
+}
+
+// parseKeyspaceEvent decodes a notification published on __keyspace@<db>__:<key>, with the event as payload,
+// or on __keyevent@<db>__:<event>, with the key as payload
+func parseKeyspaceEvent(msg *Message) (*KeyspaceEvent, error) {
+	var prefix string
+	switch {
+	case strings.HasPrefix(msg.Channel, "__keyspace@"):
+		prefix = "__keyspace@"
+	case strings.HasPrefix(msg.Channel, "__keyevent@"):
+		prefix = "__keyevent@"
+	default:
+		return nil, errors.New("not a keyspace notification")
+	}
+	rest := msg.Channel[len(prefix):]
+	i := strings.Index(rest, "__:")
+	if i < 0 {
+		return nil, errors.New("malformed keyspace notification channel")
+	}
+	db, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return nil, err
+	}
+	name := rest[i+len("__:"):]
+	if prefix == "__keyspace@" {
+		return &KeyspaceEvent{DB: db, Key: name, Event: msg.Payload}, nil
+	}
+	return &KeyspaceEvent{DB: db, Key: msg.Payload, Event: name}, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseKeyspaceEvent(t *testing.T) {
+	tables := []struct {
+		input    Message
+		expected KeyspaceEvent
+	}{
+		{Message{Channel: "__keyspace@0__:session:42", Payload: "expired"}, KeyspaceEvent{0, "session:42", "expired"}},
+		{Message{Channel: "__keyevent@3__:hset", Payload: "user:1"}, KeyspaceEvent{3, "user:1", "hset"}},
+	}
+	for _, table := range tables {
+		event, err := parseKeyspaceEvent(&table.input)
+		if err != nil {
+			t.Fatalf("test failed, expected nil, got: %s", err)
+		}
+		if *event != table.expected {
+			t.Errorf("test failed, expected: %v, got: %v", table.expected, *event)
+		}
+	}
+	if _, err := parseKeyspaceEvent(&Message{Channel: "news"}); err == nil {
+		t.Errorf("test failed, expected not nil, got: nil")
+	}
+}
+
+func TestKeyspaceListener(t *testing.T) {
+	// pmessage encodes a notification received through pattern
+	pmessage := func(pattern, channel, payload string) string {
+		return "*4\r\n" + bulk("pmessage") + bulk(pattern) + bulk(channel) + bulk(payload)
+	}
+	var mu sync.Mutex
+	var seen []string
+	client := newFakeClient(t, func(cmd []string) string {
+		mu.Lock()
+		seen = append(seen, strings.Join(cmd, " "))
+		mu.Unlock()
+		switch cmd[0] {
+		case "CONFIG":
+			return "+OK\r\n"
+		case "PSUBSCRIBE":
+			var resp string
+			for i, pattern := range cmd[1:] {
+				resp += "*3\r\n" + bulk("psubscribe") + bulk(pattern) + ":" + strconv.Itoa(i+1) + "\r\n"
+			}
+			pattern := cmd[1]
+			if strings.HasPrefix(pattern, "__keyspace@") {
+				return resp + pmessage(pattern, "__keyspace@0__:user:1", "set") +
+					pmessage(pattern, "__keyspace@0__:user:1", "expired") +
+					pmessage(pattern, "news", "del") +
+					pmessage(pattern, "__keyspace@0__:user:2", "del")
+			}
+			return resp + pmessage(pattern, "__keyevent@2__:expired", "session:1")
+		}
+		return ""
+	})
+	receive := func(kl *KeyspaceListener) *KeyspaceEvent {
+		select {
+		case event := <-kl.C():
+			return event
+		case <-time.After(time.Second):
+			t.Fatalf("test failed, expected an event, got none")
+		}
+		return nil
+	}
+
+	// the key pattern is subscribed to, the other events and the other channels are filtered out
+	kl, err := client.NewKeyspaceListener(context.Background(), KeyspaceListenerOptions{
+		KeyPattern:   "user:*",
+		Events:       []string{"set", "del"},
+		NotifyConfig: "KA",
+		Subscription: &SubscriptionOptions{PingInterval: -1},
+	})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	for _, expected := range []KeyspaceEvent{{0, "user:1", "set"}, {0, "user:2", "del"}} {
+		if event := receive(kl); *event != expected {
+			t.Errorf("test failed, expected: %v, got: %v", expected, *event)
+		}
+	}
+	kl.Close()
+	if _, ok := <-kl.C(); ok {
+		t.Errorf("test failed, expected the channel to be closed")
+	}
+	mu.Lock()
+	expected := "[CONFIG SET notify-keyspace-events KA PSUBSCRIBE __keyspace@0__:user:*]"
+	if fmt.Sprint(seen) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, seen)
+	}
+	seen = nil
+	mu.Unlock()
+
+	// only event types: their keyevent channels of every database are subscribed to, without CONFIG SET
+	kl, err = client.NewKeyspaceListener(context.Background(), KeyspaceListenerOptions{
+		DB:           -1,
+		Events:       []string{"expired", "evicted"},
+		Subscription: &SubscriptionOptions{PingInterval: -1},
+	})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer kl.Close()
+	if event, expected := receive(kl), (KeyspaceEvent{2, "session:1", "expired"}); *event != expected {
+		t.Errorf("test failed, expected: %v, got: %v", expected, *event)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := "[PSUBSCRIBE __keyevent@*__:expired __keyevent@*__:evicted]"; fmt.Sprint(seen) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, seen)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// discardLogger is the logger of the clients created without WithLogger
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// WithLogger logs the dials and the evictions of connections at the debug level, failed dials at the warn level
+// and protocol errors at the error level, to logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(rc *RedisClient) {
+		rc.logger = logger
+	}
+}
+
+// WithSlowLog logs the commands which take threshold or longer at the warn level, to the logger of WithLogger.
+// Only the name and the first argument of the commands, usually the key, are logged,
+// the other arguments are replaced with ?
+func WithSlowLog(threshold time.Duration) Option {
+	return func(rc *RedisClient) {
+		rc.slowLogThreshold = threshold
+	}
+}
+
+// sensitiveCommands have every argument redacted in the logs, they may carry passwords
+var sensitiveCommands = map[string]bool{
+	"AUTH": true, "HELLO": true, "ACL": true, "CONFIG": true, "MIGRATE": true,
+}
+
+// redactCommand returns the command name followed by its first argument, the other arguments being replaced with ?
+func redactCommand(cmd []string) string {
+	if len(cmd) == 0 {
+		return ""
+	}
+	parts := []string{strings.ToUpper(cmd[0])}
+	for i := 1; i < len(cmd); i++ {
+		if i == 1 && !sensitiveCommands[parts[0]] {
+			parts = append(parts, cmd[i])
+		} else {
+			parts = append(parts, "?")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// logSlow logs cmd if it took the slow log threshold or longer
+func (rc *RedisClient) logSlow(cmd []string, d time.Duration) {
+	if rc.slowLogThreshold > 0 && d >= rc.slowLogThreshold {
+		rc.logger.Warn("slow redis command", "cmd", redactCommand(cmd), "duration", d)
+	}
+}
+
+// isProtocolError tells whether err is a malformed reply, rather than an error reply or a network error
+func isProtocolError(err error) bool {
+	if _, ok := err.(RedisError); ok {
+		return false
+	}
+	var nerr net.Error
+	return !errors.As(err, &nerr) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) &&
+		!errors.Is(err, net.ErrClosed)
+}
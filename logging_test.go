@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := newFakeClient(t, func(cmd []string) string {
+		if cmd[0] == "GET" {
+			return "?malformed\r\n"
+		}
+		time.Sleep(5 * time.Millisecond)
+		return "+OK\r\n"
+	}, WithLogger(logger), WithSlowLog(time.Millisecond))
+	if ok, err := client.Set("k", "secret"); !ok || err != nil {
+		t.Errorf("test failed, expected: true, got: %v %v", ok, err)
+	}
+	if _, err := client.Get("k"); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	logs := buf.String()
+	for _, expected := range []string{
+		`msg="redis connection dialed" addr=` + client.pool.addr(),
+		`msg="slow redis command" cmd="SET k ?"`,
+		`msg="redis protocol error"`,
+	} {
+		if !strings.Contains(logs, expected) {
+			t.Errorf("test failed, expected: %s, got: %s", expected, logs)
+		}
+	}
+	if strings.Contains(logs, "secret") {
+		t.Errorf("test failed, expected redacted arguments, got: %s", logs)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	tables := []struct {
+		input    []string
+		expected string
+	}{
+		{[]string{"set", "k", "v"}, "SET k ?"},
+		{[]string{"AUTH", "user", "password"}, "AUTH ? ?"},
+		{[]string{"PING"}, "PING"},
+	}
+	for _, table := range tables {
+		if s := redactCommand(table.input); s != table.expected {
+			t.Errorf("test failed, expected: %s, got: %s", table.expected, s)
+		}
+	}
+}
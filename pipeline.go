@@ -6,6 +6,11 @@ type Pipeline struct {
 	pool      *ConnPool
 	cmdBuffer [][]string
 	cmdCnt    int
+	// scripts queued with AddScript, loaded when the server replies NOSCRIPT
+	scripts map[string]*Script
+	hooks   []Hook
+	// the error which left the connection out of sync, it is closed instead of being put back
+	err error
 }
 
 // AddCommand add redis command
@@ -16,24 +21,104 @@ func (p *Pipeline) AddCommand(command string, args ...string) {
 }
 
 // Exec a redis pipeline
-// returns results of queued commands
+// returns results of queued commands, an error reply is set as the errorVal of the result of its command
+// and the first one is returned as the error
 func (p *Pipeline) Exec() ([]*Reply, error) {
+	if len(p.hooks) == 0 {
+		return p.exec()
+	}
+	var res []*Reply
+	err := processPipeline(p.hooks, p.cmdBuffer, func(cmds [][]string) error {
+		p.cmdBuffer, p.cmdCnt = cmds, len(cmds)
+		var err error
+		res, err = p.exec()
+		return err
+	})
+	return res, err
+}
+
+func (p *Pipeline) exec() ([]*Reply, error) {
+	scripts := p.scripts
+	p.scripts = nil
 	err := p.conn.SendBulkCommand(p.cmdBuffer)
 	if err != nil {
+		p.err = err
 		return nil, err
 	}
+	// every reply has to be read, even after an error, to keep the connection usable
 	var res []*Reply
-	for i := p.cmdCnt; i > 0; i-- {
+	// positions of the EVALSHA of scripts missing from the scripts cache of the server
+	var missing []int
+	for i := 0; i < p.cmdCnt; i++ {
 		reply, err := p.conn.ReadResp()
 		if err != nil {
-			return nil, err
+			if _, ok := err.(RedisError); !ok {
+				p.err = err
+				return nil, err
+			}
+			if isNoScript(err) && scriptOf(scripts, p.cmdBuffer[i]) != nil {
+				missing = append(missing, i)
+			}
+			reply = &Reply{errorVal: err}
 		}
 		res = append(res, reply)
 	}
+	if len(missing) > 0 {
+		if err := p.retryScripts(scripts, missing, res); err != nil {
+			return nil, err
+		}
+	}
+	for _, reply := range res {
+		if reply.errorVal != nil {
+			return res, reply.errorVal
+		}
+	}
 	return res, nil
 }
 
-// Close a redis pipeline
+// retryScripts loads the scripts of the commands at missing, which failed with NOSCRIPT,
+// and sends them again, their replies are set in res
+func (p *Pipeline) retryScripts(scripts map[string]*Script, missing []int, res []*Reply) error {
+	loaded := make(map[*Script]bool)
+	var bulkCmd [][]string
+	for _, i := range missing {
+		if s := scriptOf(scripts, p.cmdBuffer[i]); !loaded[s] {
+			loaded[s] = true
+			bulkCmd = append(bulkCmd, []string{"SCRIPT", "LOAD", s.src})
+		}
+	}
+	loadCnt := len(bulkCmd)
+	for _, i := range missing {
+		bulkCmd = append(bulkCmd, p.cmdBuffer[i])
+	}
+	if err := p.conn.SendBulkCommand(bulkCmd); err != nil {
+		p.err = err
+		return err
+	}
+	// a script failing to load makes its EVALSHA fail anyway
+	for i := 0; i < loadCnt; i++ {
+		if _, err := p.conn.ReadResp(); err != nil {
+			if _, ok := err.(RedisError); !ok {
+				p.err = err
+				return err
+			}
+		}
+	}
+	for _, i := range missing {
+		reply, err := p.conn.ReadResp()
+		if err != nil {
+			if _, ok := err.(RedisError); !ok {
+				p.err = err
+				return err
+			}
+			reply = &Reply{errorVal: err}
+		}
+		res[i] = reply
+	}
+	return nil
+}
+
+// Close a redis pipeline, its connection is closed instead of being put back if it is out of sync
 func (p *Pipeline) Close() {
-	p.pool.ReleaseConn(p.conn)
+	p.pool.putConn(p.conn, p.err)
 }
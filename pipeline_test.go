@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPipelineErrorReplies(t *testing.T) {
+	s := NewScript("return 1")
+	loaded := false
+	client := newFakeClient(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "EVALSHA":
+			if !loaded {
+				return "-NOSCRIPT No matching script\r\n"
+			}
+			return "-ERR script failed\r\n"
+		case "SCRIPT":
+			loaded = true
+			return bulk(s.Hash())
+		case "GET":
+			return bulk("v")
+		case "PING":
+			return "+PONG\r\n"
+		case "QUIT":
+			return ""
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	// every reply is read, the error replies are set on their commands
+	p, _ := client.Pipeline()
+	p.AddScript(s, nil)
+	p.AddCommand("BAD")
+	p.AddCommand("GET", "k")
+	r, err := p.Exec()
+	if err == nil || err.Error() != "ERR script failed" {
+		t.Errorf("test failed, expected: ERR script failed, got: %v", err)
+	}
+	if len(r) != 3 || r[0].errorVal == nil || r[1].errorVal == nil || string(r[2].stringVal) != "v" {
+		t.Fatalf("test failed, expected: [ERR ERR v], got: %v", r)
+	}
+	p.Close()
+
+	// the connection put back is still in sync
+	p, _ = client.Pipeline()
+	p.AddCommand("PING")
+	if r, err := p.Exec(); err != nil || string(r[0].stringVal) != "PONG" {
+		t.Errorf("test failed, expected: PONG, got: %v %v", r, err)
+	}
+	p.Close()
+
+	// a connection failing in the middle of the replies is closed
+	p, _ = client.Pipeline()
+	p.AddCommand("QUIT")
+	p.AddCommand("GET", "k")
+	if _, err := p.Exec(); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	p.Close()
+	if stats := client.PoolStats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("test failed, expected: no connection, got: %+v", stats)
+	}
+}
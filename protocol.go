@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"io"
 	"strconv"
@@ -14,6 +13,35 @@ type Reply struct {
 	stringVal  []byte
 	integerVal int64
 	arrayVal   []*Reply
+	// error replies nested in an array, e.g. in the result of EXEC, or returned for a command of a Pipeline
+	errorVal error
+	// out of band RESP3 push data, such as pubsub messages
+	push bool
+}
+
+// mapVal indexes an array of alternating keys and values, the way maps are sent by RESP2 and read from RESP3
+func (r *Reply) mapVal() map[string]*Reply {
+	res := make(map[string]*Reply, len(r.arrayVal)/2)
+	for i := 0; i+1 < len(r.arrayVal); i += 2 {
+		res[string(r.arrayVal[i].stringVal)] = r.arrayVal[i+1]
+	}
+	return res
+}
+
+// stringsVal returns the elements of an array reply as strings
+func (r *Reply) stringsVal() []string {
+	res := make([]string, 0, len(r.arrayVal))
+	for _, e := range r.arrayVal {
+		res = append(res, string(e.stringVal))
+	}
+	return res
+}
+
+// RedisError is an error reply sent by redis server
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
 }
 
 const (
@@ -23,6 +51,16 @@ const (
 	integerStrPrefix byte   = ':'
 	errorStrPrefix   byte   = '-'
 	terminator       string = "\r\n"
+	// RESP3 types, sent after the connection has been switched to the protocol version 3 with HELLO 3
+	pushStrPrefix      byte = '>'
+	nullStrPrefix      byte = '_'
+	booleanStrPrefix   byte = '#'
+	doubleStrPrefix    byte = ','
+	bigNumberStrPrefix byte = '('
+	blobErrorStrPrefix byte = '!'
+	verbatimStrPrefix  byte = '='
+	mapStrPrefix       byte = '%'
+	setStrPrefix       byte = '~'
 )
 
 // RESPWriter encodes command into
@@ -87,74 +125,159 @@ func NewRESPReader(r io.Reader) *RESPReader {
 
 // ReadResp read resp
 func (r *RESPReader) ReadResp() (*Reply, error) {
-	prefix, _ := r.ReadByte()
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
 	switch prefix {
 	case simpleStrPrefix:
 		return r.readSimpleStr()
 	case integerStrPrefix:
-		reply, _ := r.readSimpleStr()
-		intVal, _ := strconv.ParseInt(string(reply.stringVal), 10, 64)
+		reply, err := r.readSimpleStr()
+		if err != nil {
+			return nil, err
+		}
+		intVal, err := strconv.ParseInt(string(reply.stringVal), 10, 64)
+		if err != nil {
+			return nil, err
+		}
 		return &Reply{integerVal: intVal}, nil
 	case errorStrPrefix:
-		reply, _ := r.readSimpleStr()
-		return nil, errors.New(string(reply.stringVal))
+		reply, err := r.readSimpleStr()
+		if err != nil {
+			return nil, err
+		}
+		return nil, RedisError(reply.stringVal)
 	case bulkStrPrefix:
-		//		var b bytes.Buffer
 		return r.readBulkStr()
-	case arrayStrPrefix:
+	case arrayStrPrefix, setStrPrefix:
 		return r.readArrayStr()
+	case pushStrPrefix:
+		reply, err := r.readArrayStr()
+		if err != nil {
+			return nil, err
+		}
+		reply.push = true
+		return reply, nil
+	case mapStrPrefix:
+		return r.readMap()
+	case nullStrPrefix:
+		if _, err := r.readLine(); err != nil {
+			return nil, err
+		}
+		return &Reply{}, nil
+	case booleanStrPrefix:
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if string(line) == "t" {
+			return &Reply{integerVal: 1}, nil
+		}
+		return &Reply{integerVal: 0}, nil
+	case doubleStrPrefix, bigNumberStrPrefix:
+		return r.readSimpleStr()
+	case verbatimStrPrefix:
+		reply, err := r.readBulkStr()
+		if err != nil {
+			return nil, err
+		}
+		// strip the format of the text, e.g. "txt:"
+		if len(reply.stringVal) >= 4 {
+			reply.stringVal = reply.stringVal[4:]
+		}
+		return reply, nil
+	case blobErrorStrPrefix:
+		reply, err := r.readBulkStr()
+		if err != nil {
+			return nil, err
+		}
+		return nil, RedisError(reply.stringVal)
 	default:
 		return nil, errors.New("not supported data type")
 	}
 }
 
 func (r *RESPReader) readSimpleStr() (*Reply, error) {
-	str := r.readLine()
+	str, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
 	return &Reply{stringVal: str}, nil
 }
 
-func (r *RESPReader) readLine() []byte {
-	var b bytes.Buffer
-	var c byte
-	for {
-		c, _ = r.ReadByte()
-		if c != '\r' {
-			b.WriteByte(c)
-		} else {
-			break
-		}
+// readLine reads up to the next terminator, which is consumed but not returned
+func (r *RESPReader) readLine() ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
 	}
-	// consume '\n'
-	r.ReadByte()
-	return b.Bytes()
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("malformed line in reply")
+	}
+	return line[:len(line)-2], nil
+}
+
+// readLength reads the length line of a bulk string or an array
+func (r *RESPReader) readLength() (int, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(line))
 }
 
 func (r *RESPReader) readBulkStr() (*Reply, error) {
-	var b bytes.Buffer
-	lenStr := string(r.readLine())
-	strLen, _ := strconv.Atoi(lenStr)
+	strLen, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
 	if strLen == -1 {
 		return &Reply{stringVal: nil}, nil
 	}
-	for i := strLen; i > 0; i-- {
-		c, _ := r.ReadByte()
-		b.WriteByte(c)
+	// read the string and its terminator at once
+	b := make([]byte, strLen+len(terminator))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
 	}
-	// consume '\r\n'
-	r.ReadByte()
-	r.ReadByte()
-	return &Reply{stringVal: b.Bytes()}, nil
+	return &Reply{stringVal: b[:strLen]}, nil
 }
 
 func (r *RESPReader) readArrayStr() (*Reply, error) {
 	s := make([]*Reply, 0)
-	lenStr := string(r.readLine())
-	strLen, _ := strconv.Atoi(lenStr)
+	strLen, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
 	if strLen == -1 {
 		return &Reply{arrayVal: nil}, nil
 	}
 	for i := strLen; i > 0; i-- {
 		res, err := r.ReadResp()
+		if rerr, ok := err.(RedisError); ok {
+			// keep reading the rest of the array
+			res, err = &Reply{errorVal: rerr}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, res)
+	}
+	return &Reply{arrayVal: s}, nil
+}
+
+// readMap reads a RESP3 map as an array of alternating keys and values
+func (r *RESPReader) readMap() (*Reply, error) {
+	mapLen, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	s := make([]*Reply, 0, 2*mapLen)
+	for i := 2 * mapLen; i > 0; i-- {
+		res, err := r.ReadResp()
+		if rerr, ok := err.(RedisError); ok {
+			res, err = &Reply{errorVal: rerr}, nil
+		}
 		if err != nil {
 			return nil, err
 		}
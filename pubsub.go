@@ -3,93 +3,401 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 )
 
+// the wait between reconnection attempts is doubled up to this limit
+const maxReconnectBackoff = 5 * time.Second
+
 // PubSub represents a redis pubsub pattern
 // A client subscribed to one or more channels should not issue commands, although it can subscribe and unsubscribe to and from other channels.
 // The replies to subscription and unsubscription operations are sent in the form of messages,
 // so that the client can just read a coherent stream of messages where the first element indicates the type of message.
-//The commands that are allowed in the context of a subscribed client are SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PING and QUIT.
+// The commands that are allowed in the context of a subscribed client are SUBSCRIBE, SSUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, SUNSUBSCRIBE, PUNSUBSCRIBE, PING and QUIT.
 type PubSub struct {
 	conn Conn
 	pool *ConnPool
+	// serializes the commands sent on the connection,
+	// which may happen concurrently with a Subscription reading from it
+	mu     sync.Mutex
+	closed bool
+	// channels and patterns currently subscribed, re-subscribed after a reconnection
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+	// maximum number of reconnection attempts after a connection failure, 0 for no limit, negative to disable
+	reconnectAttempts int
+	// wait before the first reconnection attempt
+	reconnectBackoff time.Duration
 }
 
 // Message is a wrapper for messages received from server
 type Message struct {
 	Channel string
+	// Pattern matched by the channel of a pmessage, or subscribed by psubscribe and punsubscribe
+	Pattern string
 	Kind    string
 	Payload string
+	// Count is the number of channels and patterns still subscribed, for subscription kinds
+	Count int64
 }
 
 func (m *Message) String() string {
+	if m.Pattern != "" {
+		return fmt.Sprintf("Channel: %s\nPattern: %s\nKind: %s\nPayload: %s\n", m.Channel, m.Pattern, m.Kind, m.Payload)
+	}
 	return fmt.Sprintf("Channel: %s\nKind: %s\nPayload: %s\n", m.Channel, m.Kind, m.Payload)
 }
 
+func (ps *PubSub) send(cmdStr ...string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return errors.New("pubsub is closed")
+	}
+	if ps.conn.conn == nil {
+		return errors.New("pubsub is reconnecting")
+	}
+	return ps.conn.SendCommand(cmdStr...)
+}
+
 // Publish a message to channel
+// The message is published through a connection of the pool,
+// since a subscribed connection is not allowed to issue PUBLISH
 func (ps *PubSub) Publish(channel, message string) error {
-	return ps.conn.SendCommand("PUBLISH", channel, message)
+	_, err := execute(ps.pool, []string{"PUBLISH", channel, message})
+	return err
 }
 
 // Subscribe a channel
 func (ps *PubSub) Subscribe(channel ...string) error {
+	ps.track(&ps.channels, true, channel)
 	cmdStr := append([]string{"SUBSCRIBE"}, channel...)
-	return ps.conn.SendCommand(cmdStr...)
+	return ps.send(cmdStr...)
 }
 
 // Unsubscribe a channel
 func (ps *PubSub) Unsubscribe(channel ...string) error {
+	ps.track(&ps.channels, false, channel)
 	cmdStr := append([]string{"UNSUBSCRIBE"}, channel...)
-	return ps.conn.SendCommand(cmdStr...)
+	return ps.send(cmdStr...)
 }
 
 // PSubscribe subscribes the client to the given patterns
 func (ps *PubSub) PSubscribe(pattern ...string) error {
+	ps.track(&ps.patterns, true, pattern)
 	cmdStr := append([]string{"PSUBSCRIBE"}, pattern...)
-	return ps.conn.SendCommand(cmdStr...)
+	return ps.send(cmdStr...)
 }
 
 // PUnsubscribe unsubscribes the client from the given patterns, or from all of them if none is given.
 func (ps *PubSub) PUnsubscribe(pattern ...string) error {
+	ps.track(&ps.patterns, false, pattern)
 	cmdStr := append([]string{"PUNSUBSCRIBE"}, pattern...)
-	return ps.conn.SendCommand(cmdStr...)
+	return ps.send(cmdStr...)
+}
+
+// SSubscribe subscribes the client to the given shard channels, introduced by redis 7 for sharded pubsub
+func (ps *PubSub) SSubscribe(shardChannel ...string) error {
+	ps.track(&ps.shardChannels, true, shardChannel)
+	cmdStr := append([]string{"SSUBSCRIBE"}, shardChannel...)
+	return ps.send(cmdStr...)
+}
+
+// SUnsubscribe unsubscribes the client from the given shard channels, or from all of them if none is given.
+func (ps *PubSub) SUnsubscribe(shardChannel ...string) error {
+	ps.track(&ps.shardChannels, false, shardChannel)
+	cmdStr := append([]string{"SUNSUBSCRIBE"}, shardChannel...)
+	return ps.send(cmdStr...)
+}
+
+// track records subscriptions to restore after a reconnection,
+// unsubscribing without names removes all of them like the server does
+func (ps *PubSub) track(set *map[string]struct{}, subscribe bool, names []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if !subscribe && len(names) == 0 {
+		*set = nil
+		return
+	}
+	if *set == nil {
+		*set = make(map[string]struct{})
+	}
+	for _, name := range names {
+		if subscribe {
+			(*set)[name] = struct{}{}
+		} else {
+			delete(*set, name)
+		}
+	}
+}
+
+// Ping the server, the reply is received as a message of kind pong
+func (ps *PubSub) Ping() error {
+	return ps.send("PING")
 }
 
 // Receive message from server
-// A message is a Array reply with three elements.
-// The first element is the kind of message:
-// 1. subscribe: means that we successfully subscribed to the channel given as the second element in the reply.
+// A message is a Array reply, or a push reply with RESP3, whose first element is the kind of message:
+// 1. subscribe, psubscribe and ssubscribe: means that we successfully subscribed to the channel, pattern or shard channel given as the second element in the reply.
 // The third argument represents the number of channels we are currently subscribed to.
-// 2. unsubscribe: means that we successfully unsubscribed from the channel given as second element in the reply.
+// 2. unsubscribe, punsubscribe and sunsubscribe: means that we successfully unsubscribed from the channel, pattern or shard channel given as second element in the reply.
 // The third argument represents the number of channels we are currently subscribed to.
 // When the last argument is zero, we are no longer subscribed to any channel, and the client can issue any kind of Redis command as we are outside the Pub/Sub state.
-// 3. message: it is a message received as result of a PUBLISH command issued by another client.
+// 3. message and smessage: it is a message received as result of a PUBLISH or SPUBLISH command issued by another client.
 // The second element is the name of the originating channel, and the third argument is the actual message payload.
+// 4. pmessage: it is a message received as result of a PUBLISH to a channel matching a subscribed pattern.
+// The second element is the pattern, the third the name of the originating channel and the fourth the payload.
+// 5. pong: the reply to Ping, the second element is the optional payload.
+// When the connection fails, Receive reconnects and subscribes again to every channel and pattern,
+// then returns a message of kind reconnect: messages published in the meantime have been missed.
 func (ps *PubSub) Receive() (*Message, error) {
+	// only Receive replaces the connection, it does not need the lock to read it
+	if ps.conn.conn == nil {
+		return nil, errors.New("pubsub is not connected")
+	}
 	reply, err := ps.conn.ReadResp()
 	if err != nil {
-		return nil, err
+		if _, ok := err.(RedisError); ok {
+			return nil, err
+		}
+		if rerr := ps.reconnect(); rerr != nil {
+			return nil, err
+		}
+		return &Message{Kind: "reconnect"}, nil
 	}
+	return parseMessage(reply)
+}
+
+func parseMessage(reply *Reply) (*Message, error) {
 	arrayReply := reply.arrayVal
+	// PING outside of the subscribed state is answered with a simple string
+	if arrayReply == nil && string(reply.stringVal) == "PONG" {
+		return &Message{Kind: "pong"}, nil
+	}
+	if len(arrayReply) < 2 {
+		return nil, errors.New("malformed pubsub message")
+	}
 	messageType := string(arrayReply[0].stringVal)
 	switch messageType {
-	case "subscribe", "unsubscribe":
+	case "subscribe", "unsubscribe", "ssubscribe", "sunsubscribe", "psubscribe", "punsubscribe":
+		if len(arrayReply) < 3 {
+			return nil, errors.New("malformed pubsub message")
+		}
+		msg := &Message{
+			Kind:  messageType,
+			Count: arrayReply[2].integerVal,
+		}
+		if messageType[0] == 'p' {
+			msg.Pattern = string(arrayReply[1].stringVal)
+		} else {
+			msg.Channel = string(arrayReply[1].stringVal)
+		}
+		return msg, nil
+	case "message", "smessage":
+		if len(arrayReply) < 3 {
+			return nil, errors.New("malformed pubsub message")
+		}
 		return &Message{
 			Kind:    messageType,
 			Channel: string(arrayReply[1].stringVal),
+			Payload: string(arrayReply[2].stringVal),
 		}, nil
-	case "message":
+	case "pmessage":
+		if len(arrayReply) < 4 {
+			return nil, errors.New("malformed pubsub message")
+		}
 		return &Message{
 			Kind:    messageType,
-			Channel: string(arrayReply[1].stringVal),
-			Payload: string(arrayReply[2].stringVal),
+			Pattern: string(arrayReply[1].stringVal),
+			Channel: string(arrayReply[2].stringVal),
+			Payload: string(arrayReply[3].stringVal),
+		}, nil
+	case "pong":
+		return &Message{
+			Kind:    messageType,
+			Payload: string(arrayReply[1].stringVal),
 		}, nil
 	default:
 		return nil, errors.New("not supported message type")
 	}
 }
 
+// reconnect replaces a failed connection with a new one from the pool,
+// retrying with backoff, and restores the subscriptions on it
+func (ps *PubSub) reconnect() error {
+	ps.mu.Lock()
+	if ps.closed || ps.reconnectAttempts < 0 {
+		ps.mu.Unlock()
+		return errors.New("pubsub is closed")
+	}
+	ps.pool.RemoveConn(ps.conn)
+	// commands sent until the new connection is ready fail, the subscriptions are tracked anyway
+	ps.conn = Conn{}
+	ps.mu.Unlock()
+
+	backoff := ps.reconnectBackoff
+	for attempt := 1; ; attempt++ {
+		c, err := ps.pool.GetConn()
+		if err == nil {
+			if err = ps.resubscribe(c); err == nil {
+				return nil
+			}
+			ps.pool.RemoveConn(c)
+		}
+		if ps.isClosed() || ps.reconnectAttempts > 0 && attempt >= ps.reconnectAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// resubscribe installs c as the connection of the pubsub and subscribes to the tracked channels, patterns and shard channels
+// The confirmations are received as subscribe, psubscribe and ssubscribe messages.
+func (ps *PubSub) resubscribe(c Conn) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return errors.New("pubsub is closed")
+	}
+	var bulkCmd [][]string
+	if len(ps.channels) > 0 {
+		cmdStr := []string{"SUBSCRIBE"}
+		for channel := range ps.channels {
+			cmdStr = append(cmdStr, channel)
+		}
+		bulkCmd = append(bulkCmd, cmdStr)
+	}
+	if len(ps.patterns) > 0 {
+		cmdStr := []string{"PSUBSCRIBE"}
+		for pattern := range ps.patterns {
+			cmdStr = append(cmdStr, pattern)
+		}
+		bulkCmd = append(bulkCmd, cmdStr)
+	}
+	if len(ps.shardChannels) > 0 {
+		cmdStr := []string{"SSUBSCRIBE"}
+		for shardChannel := range ps.shardChannels {
+			cmdStr = append(cmdStr, shardChannel)
+		}
+		bulkCmd = append(bulkCmd, cmdStr)
+	}
+	if len(bulkCmd) > 0 {
+		if err := c.SendBulkCommand(bulkCmd); err != nil {
+			return err
+		}
+	}
+	ps.conn = c
+	return nil
+}
+
+func (ps *PubSub) isClosed() bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.closed
+}
+
+// setReadDeadline sets the read deadline of the current connection
+func (ps *PubSub) setReadDeadline(t time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn.conn != nil {
+		ps.conn.setReadDeadline(t)
+	}
+}
+
 // Close the pubsub connection
+// The connection is closed rather than put back into the pool, as it may still be in the subscribed state
 func (ps *PubSub) Close() {
-	ps.pool.ReleaseConn(ps.conn)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return
+	}
+	ps.closed = true
+	if ps.conn.conn != nil {
+		ps.pool.RemoveConn(ps.conn)
+	}
+}
+
+// Publish posts a message to the given channel
+// returns the number of clients that received the message
+func (rc *RedisClient) Publish(channel, message string) (int64, error) {
+	reply, err := rc.executeCommand("PUBLISH", channel, message)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// SPublish posts a message to the given shard channel
+// returns the number of clients that received the message
+func (rc *RedisClient) SPublish(shardChannel, message string) (int64, error) {
+	reply, err := rc.executeCommand("SPUBLISH", shardChannel, message)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// PubSubChannels lists the currently active channels, matching pattern if it is not empty
+// An active channel is a channel with one or more subscribers, not including clients subscribed to patterns.
+func (rc *RedisClient) PubSubChannels(pattern string) ([]string, error) {
+	return rc.pubSubList("CHANNELS", pattern)
+}
+
+// PubSubShardChannels lists the currently active shard channels, matching pattern if it is not empty
+func (rc *RedisClient) PubSubShardChannels(pattern string) ([]string, error) {
+	return rc.pubSubList("SHARDCHANNELS", pattern)
+}
+
+func (rc *RedisClient) pubSubList(subcommand, pattern string) ([]string, error) {
+	args := []string{subcommand}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	reply, err := rc.executeCommand("PUBSUB", args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		res = append(res, string(r.stringVal))
+	}
+	return res, nil
+}
+
+// PubSubNumSub returns the number of subscribers, not counting clients subscribed to patterns, for the given channels
+func (rc *RedisClient) PubSubNumSub(channels ...string) (map[string]int64, error) {
+	return rc.pubSubCount("NUMSUB", channels)
+}
+
+// PubSubShardNumSub returns the number of subscribers for the given shard channels
+func (rc *RedisClient) PubSubShardNumSub(shardChannels ...string) (map[string]int64, error) {
+	return rc.pubSubCount("SHARDNUMSUB", shardChannels)
+}
+
+func (rc *RedisClient) pubSubCount(subcommand string, channels []string) (map[string]int64, error) {
+	reply, err := rc.executeCommand("PUBSUB", append([]string{subcommand}, channels...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64, len(reply.arrayVal)/2)
+	for i := 0; i+1 < len(reply.arrayVal); i += 2 {
+		res[string(reply.arrayVal[i].stringVal)] = reply.arrayVal[i+1].integerVal
+	}
+	return res, nil
+}
+
+// PubSubNumPat returns the number of unique patterns subscribed to by all clients
+func (rc *RedisClient) PubSubNumPat() (int64, error) {
+	reply, err := rc.executeCommand("PUBSUB", "NUMPAT")
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
 }
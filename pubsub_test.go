@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestPublishBrokenConn(t *testing.T) {
+	host, port := newFakeServer(t, func(cmd []string) string {
+		return ""
+	})
+	ps := &PubSub{pool: NewConnPool(host, port, 1)}
+	if err := ps.Publish("ch", "hello"); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	if stats := ps.pool.Stats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("test failed, expected: no connection, got: %+v", stats)
+	}
+}
+
+func TestPubSubReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	pool := NewConnPool(host, port, 2)
+	pool.inUseCnt = 1
+
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, server)
+	ps := &PubSub{
+		conn: Conn{conn: client, respReader: NewRESPReader(client), respWriter: NewRESPWriter(client)},
+		pool: pool,
+	}
+	ps.Subscribe("news")
+	ps.PSubscribe("sport.*")
+	// the server drops the connection
+	server.Close()
+
+	resubscribed := make(chan [][]string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		r := NewRESPReader(c)
+		var cmds [][]string
+		for i := 0; i < 2; i++ {
+			reply, err := r.ReadResp()
+			if err != nil {
+				break
+			}
+			var cmd []string
+			for _, arg := range reply.arrayVal {
+				cmd = append(cmd, string(arg.stringVal))
+			}
+			cmds = append(cmds, cmd)
+		}
+		resubscribed <- cmds
+	}()
+
+	msg, err := ps.Receive()
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if msg.Kind != "reconnect" {
+		t.Errorf("test failed, expected: reconnect, got: %s", msg.Kind)
+	}
+	cmds := <-resubscribed
+	if len(cmds) != 2 || cmds[0][0] != "SUBSCRIBE" || cmds[0][1] != "news" || cmds[1][0] != "PSUBSCRIBE" || cmds[1][1] != "sport.*" {
+		t.Errorf("test failed, expected: [[SUBSCRIBE news] [PSUBSCRIBE sport.*]], got: %v", cmds)
+	}
+	ps.Close()
+}
+
+func TestReceiveMessageKinds(t *testing.T) {
+	ps := &PubSub{
+		conn: newTestConn("*3\r\n$10\r\npsubscribe\r\n$4\r\nnew*\r\n:1\r\n" +
+			"*4\r\n$8\r\npmessage\r\n$4\r\nnew*\r\n$4\r\nnews\r\n$2\r\nhi\r\n" +
+			">3\r\n$8\r\nsmessage\r\n$5\r\nshard\r\n$3\r\nhey\r\n" +
+			">2\r\n$4\r\npong\r\n$0\r\n\r\n"),
+		pool: NewConnPool("127.0.0.1", "6379", 1),
+	}
+	tables := []Message{
+		{Kind: "psubscribe", Pattern: "new*", Count: 1},
+		{Kind: "pmessage", Pattern: "new*", Channel: "news", Payload: "hi"},
+		{Kind: "smessage", Channel: "shard", Payload: "hey"},
+		{Kind: "pong"},
+	}
+	for _, expected := range tables {
+		msg, err := ps.Receive()
+		if err != nil {
+			t.Fatalf("test failed, expected nil, got: %s", err)
+		}
+		if *msg != expected {
+			t.Errorf("test failed, expected: %s, got: %s", &expected, msg)
+		}
+	}
+}
@@ -1,37 +1,171 @@
 package main
 
 import (
-	"errors"
-	"fmt"
+	"context"
+	"log/slog"
 	"runtime"
 	"strconv"
+	"time"
 )
 
 // RedisClient represent a redis client
 type RedisClient struct {
 	pool *ConnPool
+	// how many times Watch runs a transaction aborted by a concurrent modification
+	txMaxAttempts int
+	// wait before the first retry of an aborted transaction, doubled on every retry
+	txRetryBackoff time.Duration
+	// reconnection attempts and initial backoff of PubSub after a connection failure
+	pubSubReconnectAttempts int
+	pubSubReconnectBackoff  time.Duration
+	// steps run by NewRedisClient once the options are applied
+	onStart []func() error
+	// follows the master elected by sentinels, for clients created by NewFailoverClient
+	sentinel *sentinelWatcher
+	// how many MOVED and ASK redirections, TRYAGAIN, CLUSTERDOWN and network errors a ClusterClient follows for a command
+	maxRedirects int
+	// called around the commands, the pipelines and the dials
+	hooks []Hook
+	// routes the read-only commands to replicas when it is set
+	replicas *replicaRouter
+	// sends a command and reads its reply, on pool or on the node chosen by a ClusterClient
+	process func(cmd []string) (*Reply, error)
+	logger  *slog.Logger
+	// commands taking this long or longer are logged, 0 disables the slow log
+	slowLogThreshold time.Duration
+	// retries of the commands failed by a transient error, and bounds of the wait between them
+	maxRetries      int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	// commands retried after a network error besides the read-only and the idempotent ones
+	idempotentCommands map[string]bool
+	// key positions and flags of the commands, from COMMAND, for the cluster and ring clients
+	commands map[string]*CommandInfo
+	// configures a circuit breaker per connection pool when it is set
+	breakerOpts *BreakerOptions
+}
+
+// Option configures a RedisClient
+type Option func(*RedisClient)
+
+// WithTxRetry sets how many times Watch attempts a transaction whose watched keys were modified,
+// and how long it waits before retrying, the wait is doubled after every attempt
+func WithTxRetry(attempts int, backoff time.Duration) Option {
+	return func(rc *RedisClient) {
+		rc.txMaxAttempts = attempts
+		rc.txRetryBackoff = backoff
+	}
+}
+
+// WithPubSubReconnect sets how many times a PubSub attempts to reconnect after a connection failure,
+// 0 for no limit and a negative value to disable reconnection,
+// and how long it waits before the first retry, the wait is doubled after every attempt
+func WithPubSubReconnect(attempts int, backoff time.Duration) Option {
+	return func(rc *RedisClient) {
+		rc.pubSubReconnectAttempts = attempts
+		rc.pubSubReconnectBackoff = backoff
+	}
 }
 
 // NewRedisClient returns a new Redis client
-func NewRedisClient(host, port string) (*RedisClient, error) {
-	pool := NewConnPool(host, port, 10*runtime.NumCPU())
-	return &RedisClient{
-		pool: pool,
-	}, nil
+func NewRedisClient(host, port string, opts ...Option) (*RedisClient, error) {
+	rc := newRedisClient(NewConnPool(host, port, 10*runtime.NumCPU()), opts)
+	if err := rc.start(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// newRedisClient returns a client sending its commands on pool, with the options applied
+func newRedisClient(pool *ConnPool, opts []Option) *RedisClient {
+	rc := &RedisClient{
+		pool:                   pool,
+		txMaxAttempts:          3,
+		txRetryBackoff:         10 * time.Millisecond,
+		pubSubReconnectBackoff: 100 * time.Millisecond,
+		maxRedirects:           3,
+		logger:                 discardLogger,
+		minRetryBackoff:        8 * time.Millisecond,
+		maxRetryBackoff:        512 * time.Millisecond,
+	}
+	rc.process = func(cmd []string) (*Reply, error) {
+		if rc.replicas != nil && isReadOnly(cmd, nil) {
+			reply, err := rc.replicas.do(rc.replicas.replicaAddrs(), cmd)
+			if err != errNoReplica {
+				return reply, err
+			}
+		}
+		return execute(rc.pool, cmd)
+	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	pool.hooks = rc.hooks
+	pool.logger = rc.logger
+	pool.breaker = newCircuitBreaker(rc.breakerOpts, pool)
+	if rc.replicas != nil {
+		rc.replicas.hooks = rc.hooks
+		rc.replicas.logger = rc.logger
+		rc.replicas.breakerOpts = rc.breakerOpts
+	}
+	return rc
+}
+
+// start runs the steps registered by the options, the pool is closed if one fails
+func (rc *RedisClient) start() error {
+	for _, fn := range rc.onStart {
+		if err := fn(); err != nil {
+			rc.pool.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// PoolStats returns the state of the connection pool of the client
+func (rc *RedisClient) PoolStats() PoolStats {
+	return rc.pool.Stats()
+}
+
+// Close closes the connections of the client
+func (rc *RedisClient) Close() error {
+	if rc.sentinel != nil {
+		rc.sentinel.stop()
+	}
+	if rc.replicas != nil {
+		rc.replicas.close()
+	}
+	rc.pool.Close()
+	return nil
 }
 
 func (rc *RedisClient) executeCommand(command string, args ...string) (*Reply, error) {
-	c, err := rc.pool.GetConn()
+	cmd := append([]string{command}, args...)
+	start := time.Now()
+	defer func() { rc.logSlow(cmd, time.Since(start)) }()
+	if len(rc.hooks) > 0 {
+		return rc.processWithHooks(context.Background(), cmd)
+	}
+	return rc.processWithRetry(cmd)
+}
+
+// execute sends cmd on a connection of pool and reads its reply
+func execute(pool *ConnPool, cmd []string) (*Reply, error) {
+	c, err := pool.GetConn()
 	if err != nil {
 		return nil, err
 	}
-	defer rc.pool.ReleaseConn(c)
-	commands := append([]string{command}, args...)
-	err = c.SendCommand(commands...)
+	err = c.SendCommand(cmd...)
 	if err != nil {
+		pool.putConn(c, err)
 		return nil, err
 	}
-	return c.ReadResp()
+	reply, err := c.ReadResp()
+	if err != nil && isProtocolError(err) {
+		pool.logger.Error("redis protocol error", "addr", pool.addr(), "cmd", redactCommand(cmd), "err", err)
+	}
+	pool.putConn(c, err)
+	return reply, err
 }
 
 // Get the value of key. If the key does not exist the special value nil is returned.
@@ -51,41 +185,24 @@ func (rc *RedisClient) Set(key, val string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if string(reply.stringVal) == "OK" {
-		return true, nil
-	}
-	fmt.Printf("reply: %s\n", reply.stringVal)
-	return false, err
+	return string(reply.stringVal) == "OK", nil
 }
 
 // Expire set a timeout on key
 // return true if the timeout was set.
-// return false if key does not exist
-func (rc *RedisClient) Expire(key string, sec int) (bool, error) {
-	reply, err := rc.executeCommand("EXPIRE", key, strconv.Itoa(sec))
-	if err != nil {
-		return false, err
-	}
-	if reply.integerVal == 1 {
-		return true, nil
-	}
-	return false, nil
+// return false if key does not exist, or the timeout was not set because of cond
+func (rc *RedisClient) Expire(key string, sec int, cond ...ExpireCondition) (bool, error) {
+	return rc.expire("EXPIRE", key, strconv.Itoa(sec), cond)
 }
 
 // TTL Returns the remaining time to live of a key that has a timeout.
-func (rc *RedisClient) TTL(key string) (int64, error) {
+// returns NoExpiration if the key exists but has no associated expire, KeyNotFound if the key does not exist
+func (rc *RedisClient) TTL(key string) (time.Duration, error) {
 	reply, err := rc.executeCommand("TTL", key)
 	if err != nil {
 		return 0, err
 	}
-	if reply.integerVal >= 0 {
-		return reply.integerVal, nil
-	} else if reply.integerVal == -1 {
-		return 0, errors.New("key exists but has no associated expire")
-	} else if reply.integerVal == -2 {
-		return 0, errors.New("key does not exist")
-	}
-	return 0, errors.New("unknown error")
+	return ttlDuration(reply.integerVal, time.Second), nil
 }
 
 // Keys returns all keys matching pattern
@@ -174,23 +291,16 @@ func (rc *RedisClient) IncrByFloat(key string, inc float64) (float64, error) {
 
 // Scan incrementally iterate over a collection of keys
 func (rc *RedisClient) Scan(cursor int64, pattern string, count int64) (int64, []string, error) {
-	args := []string{strconv.FormatInt(cursor, 10)}
-	if pattern != "" {
-		args = append(args, "MATCH", pattern)
-	}
-	if count != 0 {
-		args = append(args, "COUNT", strconv.FormatInt(count, 10))
-	}
-	reply, err := rc.executeCommand("SCAN", args...)
+	nextCursor, keys, err := rc.scanPage("SCAN", "", strconv.FormatUint(uint64(cursor), 10), ScanArgs{Match: pattern, Count: count})
 	if err != nil {
 		return 0, nil, err
 	}
-	nextCursor, _ := strconv.ParseInt(string(reply.arrayVal[0].stringVal), 10, 64)
-	keys := make([]string, 0)
-	for _, k := range reply.arrayVal[1].arrayVal {
-		keys = append(keys, string(k.stringVal))
+	// cursors are unsigned 64 bit integers
+	next, err := strconv.ParseUint(nextCursor, 10, 64)
+	if err != nil {
+		return 0, nil, err
 	}
-	return nextCursor, keys, nil
+	return int64(next), keys, nil
 }
 
 // Del Removes the specified keys. A key is ignored if it does not exist.
@@ -209,8 +319,9 @@ func (rc *RedisClient) Pipeline() (*Pipeline, error) {
 		return nil, err
 	}
 	return &Pipeline{
-		conn: c,
-		pool: rc.pool,
+		conn:  c,
+		pool:  rc.pool,
+		hooks: rc.hooks,
 	}, nil
 }
 
@@ -233,8 +344,10 @@ func (rc *RedisClient) PubSub() (*PubSub, error) {
 		return nil, err
 	}
 	return &PubSub{
-		conn: c,
-		pool: rc.pool,
+		conn:              c,
+		pool:              rc.pool,
+		reconnectAttempts: rc.pubSubReconnectAttempts,
+		reconnectBackoff:  rc.pubSubReconnectBackoff,
 	}, nil
 }
 
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicaPolicy chooses the replica serving a read-only command
+type ReplicaPolicy int
+
+const (
+	// ReplicaRandom picks a random replica
+	ReplicaRandom ReplicaPolicy = iota
+	// ReplicaRoundRobin picks the replicas in turn
+	ReplicaRoundRobin
+	// ReplicaLowestLatency picks the replica with the lowest average command latency,
+	// replicas which have not served a command yet are tried first
+	ReplicaLowestLatency
+	// ReplicaSameZone picks a random replica in the zone of the client, or any replica if there is none
+	ReplicaSameZone
+)
+
+// replicaDownTime is how long a replica is skipped after a connection failure
+const replicaDownTime = 5 * time.Second
+
+// ReplicaOptions configures the routing of read-only commands to replicas
+type ReplicaOptions struct {
+	Policy ReplicaPolicy
+	// Replicas are the host:port addresses of the replicas of a standalone master,
+	// the clients created by NewFailoverClient and NewClusterClient discover them
+	Replicas []string
+	// Zone is the zone of the client and NodeZone returns the zone of a node, for ReplicaSameZone
+	Zone     string
+	NodeZone func(addr string) string
+}
+
+// WithReplicaReads sends the read-only commands to the replicas chosen by opts.Policy,
+// they are sent to the master when no replica is available or the replica fails.
+// Pipelines, transactions and scripts other than EVAL_RO, EVALSHA_RO and FCALL_RO always run on the master.
+func WithReplicaReads(opts ReplicaOptions) Option {
+	return func(rc *RedisClient) {
+		rc.replicas = newReplicaRouter(opts)
+	}
+}
+
+// readOnlyCommands are the commands sent to replicas when the flags of COMMAND are not known
+var readOnlyCommands = map[string]bool{}
+
+func init() {
+	for _, c := range strings.Fields(`get mget strlen getrange substr exists type ttl pttl expiretime pexpiretime
+		hget hmget hgetall hkeys hvals hlen hexists hstrlen hrandfield hscan
+		lrange lindex llen lpos
+		scard sismember smismember smembers srandmember sinter sintercard sunion sdiff sscan
+		zcard zcount zrange zrangebyscore zrangebylex zrevrange zrevrangebyscore zrevrangebylex zrank zrevrank
+		zscore zmscore zlexcount zrandmember zscan zunion zinter zintercard zdiff
+		xrange xrevrange xlen xread
+		getbit bitcount bitpos bitfield_ro pfcount
+		geopos geodist geohash geosearch georadius_ro georadiusbymember_ro
+		dump sort_ro eval_ro evalsha_ro fcall_ro`) {
+		readOnlyCommands[c] = true
+	}
+}
+
+// isReadOnly tells whether cmd can be served by a replica, from the flags of commands when it is described
+func isReadOnly(cmd []string, commands map[string]*CommandInfo) bool {
+	name := strings.ToLower(cmd[0])
+	if name == "xread" {
+		// a blocking XREAD waits for entries written on the master
+		for _, arg := range cmd {
+			if strings.EqualFold(arg, "BLOCK") {
+				return false
+			}
+		}
+	}
+	if ci, ok := commands[name]; ok {
+		return ci.HasFlag("readonly") && !ci.HasFlag("blocking")
+	}
+	return readOnlyCommands[name]
+}
+
+// errNoReplica is returned by replicaRouter.do when the command has to be sent to the master
+var errNoReplica = errors.New("no replica available")
+
+// replicaRouter sends read-only commands to replicas
+type replicaRouter struct {
+	opts ReplicaOptions
+	// sent on every new connection to a replica, READONLY for cluster replicas
+	initCmds [][]string
+	hooks    []Hook
+	logger   *slog.Logger
+	// configures a circuit breaker per replica when it is set
+	breakerOpts *BreakerOptions
+	mu          sync.Mutex
+	// replicas of a standalone or sentinel-managed master
+	addrs     []string
+	pools     map[string]*ConnPool
+	latency   map[string]time.Duration
+	downUntil map[string]time.Time
+	next      int
+}
+
+func newReplicaRouter(opts ReplicaOptions) *replicaRouter {
+	return &replicaRouter{
+		opts:      opts,
+		logger:    discardLogger,
+		addrs:     opts.Replicas,
+		pools:     make(map[string]*ConnPool),
+		latency:   make(map[string]time.Duration),
+		downUntil: make(map[string]time.Time),
+	}
+}
+
+// setAddrs replaces the replicas of the master, the pools of the removed ones are closed
+func (r *replicaRouter) setAddrs(addrs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs = addrs
+	keep := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		keep[addr] = true
+	}
+	for addr, pool := range r.pools {
+		if !keep[addr] {
+			pool.Close()
+			delete(r.pools, addr)
+		}
+	}
+}
+
+func (r *replicaRouter) replicaAddrs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs
+}
+
+// pick chooses a replica among candidates, skipping the ones which failed recently
+func (r *replicaRouter) pick(candidates []string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	up := make([]string, 0, len(candidates))
+	for _, addr := range candidates {
+		if now.After(r.downUntil[addr]) {
+			up = append(up, addr)
+		}
+	}
+	if len(up) == 0 {
+		return "", false
+	}
+	switch r.opts.Policy {
+	case ReplicaRoundRobin:
+		r.next++
+		return up[r.next%len(up)], true
+	case ReplicaLowestLatency:
+		best := up[0]
+		for _, addr := range up[1:] {
+			if r.latency[addr] < r.latency[best] {
+				best = addr
+			}
+		}
+		return best, true
+	case ReplicaSameZone:
+		if r.opts.NodeZone != nil {
+			var local []string
+			for _, addr := range up {
+				if r.opts.NodeZone(addr) == r.opts.Zone {
+					local = append(local, addr)
+				}
+			}
+			if len(local) > 0 {
+				up = local
+			}
+		}
+	}
+	return up[rand.Intn(len(up))], true
+}
+
+func (r *replicaRouter) pool(addr string) *ConnPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pool, ok := r.pools[addr]; ok {
+		return pool
+	}
+	pool := newNodePool(addr)
+	pool.initCmds = r.initCmds
+	pool.hooks = r.hooks
+	pool.logger = r.logger
+	pool.breaker = newCircuitBreaker(r.breakerOpts, pool)
+	r.pools[addr] = pool
+	return pool
+}
+
+// observe records the outcome of a command sent to a replica
+func (r *replicaRouter) observe(addr string, d time.Duration, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if failed {
+		r.downUntil[addr] = time.Now().Add(replicaDownTime)
+		return
+	}
+	// exponentially weighted moving average
+	if avg, ok := r.latency[addr]; ok {
+		d = (avg*7 + d) / 8
+	}
+	r.latency[addr] = d
+}
+
+// do sends cmd to a replica chosen among candidates
+// returns errNoReplica when the command has to be sent to the master instead:
+// there is no available replica, the replica is unreachable or does not serve the slot of the command
+func (r *replicaRouter) do(candidates []string, cmd []string) (*Reply, error) {
+	addr, ok := r.pick(candidates)
+	if !ok {
+		return nil, errNoReplica
+	}
+	start := time.Now()
+	reply, err := execute(r.pool(addr), cmd)
+	if err != nil {
+		rerr, ok := err.(RedisError)
+		if !ok {
+			r.observe(addr, 0, true)
+			return nil, errNoReplica
+		}
+		if isClusterRetryable(rerr) || strings.HasPrefix(string(rerr), "LOADING") || strings.HasPrefix(string(rerr), "MASTERDOWN") {
+			return nil, errNoReplica
+		}
+		return nil, err
+	}
+	r.observe(addr, time.Since(start), false)
+	return reply, nil
+}
+
+func (r *replicaRouter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, pool := range r.pools {
+		pool.Close()
+	}
+}
+
+// newNodePool returns a pool of connections to the node at the host:port address addr
+func newNodePool(addr string) *ConnPool {
+	host, port, _ := net.SplitHostPort(addr)
+	return NewConnPool(host, port, 10*runtime.NumCPU())
+}
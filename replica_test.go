@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplicaReads(t *testing.T) {
+	newNode := func(name string) string {
+		host, port := newFakeServer(t, func(cmd []string) string {
+			if cmd[0] == "GET" {
+				return fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
+			}
+			return "+" + name + "\r\n"
+		})
+		return net.JoinHostPort(host, port)
+	}
+	master, replica := newNode("m"), newNode("r")
+	host, port, _ := net.SplitHostPort(master)
+	client, err := NewRedisClient(host, port, WithReplicaReads(ReplicaOptions{
+		Policy:   ReplicaRoundRobin,
+		Replicas: []string{replica, "127.0.0.1:1"},
+	}))
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	// the unreachable replica is picked first, the command falls back to the master and the replica is skipped
+	var got []string
+	for i := 0; i < 3; i++ {
+		val, _ := client.Get("k")
+		got = append(got, string(val))
+	}
+	if fmt.Sprint(got) != "[m r r]" {
+		t.Errorf("test failed, expected: [m r r], got: %v", got)
+	}
+	if reply, err := client.executeCommand("SET", "k", "v"); err != nil || string(reply.stringVal) != "m" {
+		t.Errorf("test failed, expected: m, got: %v (%v)", reply, err)
+	}
+
+	r := newReplicaRouter(ReplicaOptions{
+		Policy:   ReplicaSameZone,
+		Zone:     "b",
+		NodeZone: func(addr string) string { return addr[:1] },
+	})
+	if addr, _ := r.pick([]string{"a:1", "b:1"}); addr != "b:1" {
+		t.Errorf("test failed, expected: b:1, got: %s", addr)
+	}
+	r.opts.Policy = ReplicaLowestLatency
+	r.observe("a:1", time.Millisecond, false)
+	r.observe("b:1", 2*time.Millisecond, false)
+	if addr, _ := r.pick([]string{"a:1", "b:1"}); addr != "a:1" {
+		t.Errorf("test failed, expected: a:1, got: %s", addr)
+	}
+}
+
+func TestClusterReplicaReads(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	replicaHost, replicaPort := newFakeServer(t, func(cmd []string) string {
+		mu.Lock()
+		received = append(received, strings.Join(cmd, " "))
+		mu.Unlock()
+		if cmd[0] == "READONLY" {
+			return "+OK\r\n"
+		}
+		return "$1\r\nr\r\n"
+	})
+	var masterHost, masterPort string
+	masterHost, masterPort = newFakeServer(t, func(cmd []string) string {
+		switch strings.Join(cmd, " ") {
+		case "CLUSTER SHARDS", "COMMAND":
+			return "-ERR unknown subcommand\r\n"
+		case "CLUSTER SLOTS":
+			return fmt.Sprintf("*1\r\n*4\r\n:0\r\n:16383\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n",
+				len(masterHost), masterHost, masterPort, len(replicaHost), replicaHost, replicaPort)
+		}
+		return "$1\r\nm\r\n"
+	})
+	client, err := NewClusterClient([]string{net.JoinHostPort(masterHost, masterPort)}, WithReplicaReads(ReplicaOptions{}))
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	if val, err := client.Get("foo"); err != nil || string(val) != "r" {
+		t.Errorf("test failed, expected: r, got: %s (%v)", val, err)
+	}
+	// writes are sent to the master
+	client.Incr("foo")
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(received) != "[READONLY GET foo]" {
+		t.Errorf("test failed, expected: [READONLY GET foo], got: %v", received)
+	}
+}
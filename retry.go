@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// WithRetry enables the retries of the commands failed by a transient error, which are disabled by default:
+// maxRetries is how many times a command is retried, minBackoff and maxBackoff bound the wait between two attempts,
+// doubled after every attempt and jittered.
+//
+// A command rejected with LOADING or BUSY was not run, it is always retried.
+// TRYAGAIN is left to the ClusterClient, which retries it with the redirections.
+// A command failed by a network error may have been run, it is only retried when it is idempotent:
+// the read-only commands and the writes of idempotentCommands or WithIdempotentCommands.
+// The broken connection is closed, the next attempt runs on another connection of the pool, dialed if needed.
+func WithRetry(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(rc *RedisClient) {
+		rc.maxRetries = maxRetries
+		rc.minRetryBackoff = minBackoff
+		rc.maxRetryBackoff = maxBackoff
+	}
+}
+
+// WithIdempotentCommands marks more commands as safe to retry after a network error, e.g. scripts known to be idempotent
+func WithIdempotentCommands(names ...string) Option {
+	return func(rc *RedisClient) {
+		if rc.idempotentCommands == nil {
+			rc.idempotentCommands = make(map[string]bool)
+		}
+		for _, name := range names {
+			rc.idempotentCommands[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// idempotentCommands are the writes which leave the same state when they are run twice
+var idempotentCommands = map[string]bool{}
+
+func init() {
+	for _, c := range strings.Fields(`ping echo set mset hset hmset hdel sadd srem zadd zrem
+		del unlink expireat pexpireat persist setbit setrange pfadd geoadd`) {
+		idempotentCommands[c] = true
+	}
+}
+
+// zaddOptions are the options of ZADD
+var zaddOptions = map[string]bool{"NX": true, "XX": true, "GT": true, "LT": true, "CH": true, "INCR": true}
+
+// isIdempotent tells whether cmd can be retried after a network error
+func (rc *RedisClient) isIdempotent(cmd []string) bool {
+	name := strings.ToLower(cmd[0])
+	if isReadOnly(cmd, rc.commands) || rc.idempotentCommands[name] {
+		return true
+	}
+	if !idempotentCommands[name] {
+		return false
+	}
+	// the increments of ZADD INCR and the conditional sets of SET GET and SET NX change with the state,
+	// only the option positions are inspected: a value or a member may be named like an option
+	var options []string
+	switch name {
+	case "set":
+		if len(cmd) > 3 {
+			options = cmd[3:]
+		}
+	case "zadd":
+		// the options come before the first score
+		end := min(2, len(cmd))
+		for end < len(cmd) && zaddOptions[strings.ToUpper(cmd[end])] {
+			end++
+		}
+		options = cmd[2:end]
+	}
+	for _, arg := range options {
+		switch strings.ToUpper(arg) {
+		case "INCR", "GET", "NX":
+			return false
+		}
+	}
+	return true
+}
+
+// isNetworkError tells whether err left the connection broken, the command may or may not have been run
+func isNetworkError(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isTransient tells whether err is a reply of a server which did not run the command and may run it later
+func isTransient(err error) bool {
+	rerr, ok := err.(RedisError)
+	if !ok {
+		return false
+	}
+	for _, prefix := range []string{"LOADING ", "BUSY "} {
+		if strings.HasPrefix(string(rerr), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff returns the wait before the retry following attempt, from 0:
+// minRetryBackoff doubled after every attempt up to maxRetryBackoff, of which a random half is kept
+func (rc *RedisClient) retryBackoff(attempt int) time.Duration {
+	d := rc.minRetryBackoff
+	for i := 0; i < attempt && d < rc.maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > rc.maxRetryBackoff {
+		d = rc.maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// processWithRetry sends cmd through process, retrying it as configured by WithRetry
+func (rc *RedisClient) processWithRetry(cmd []string) (*Reply, error) {
+	for attempt := 0; ; attempt++ {
+		reply, err := rc.process(cmd)
+		if err == nil || attempt >= rc.maxRetries || !isTransient(err) && !(isNetworkError(err) && rc.isIdempotent(cmd)) {
+			return reply, err
+		}
+		rc.logger.Debug("retrying redis command", "cmd", redactCommand(cmd), "attempt", attempt+1, "err", err)
+		time.Sleep(rc.retryBackoff(attempt))
+	}
+}
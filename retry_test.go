@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	client := newFakeClient(t, func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[cmd[0]]++
+		switch {
+		case cmd[0] == "SET" && seen["SET"] <= 2:
+			return "-LOADING Redis is loading the dataset in memory\r\n"
+		case seen[cmd[0]] == 1:
+			// the first GET and the first INCR break the connection
+			return ""
+		case cmd[0] == "INCR":
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	}, WithRetry(3, time.Millisecond, 4*time.Millisecond))
+	// a command rejected with LOADING is retried
+	if ok, err := client.Set("k", "v"); !ok || err != nil {
+		t.Errorf("test failed, expected: true, got: %v %v", ok, err)
+	}
+	// a read is retried on a new connection after a network error
+	if _, err := client.Get("k"); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	// an increment is not, it may have been run
+	if _, err := client.Incr("k"); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	expected := "map[GET:2 INCR:1 SET:3]"
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(seen) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, seen)
+	}
+	// the connection broken by INCR was closed instead of being put back
+	if stats := client.PoolStats(); stats.InUse != 0 || stats.Idle != 0 {
+		t.Errorf("test failed, expected: no connection, got: %+v", stats)
+	}
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	var sets int32
+	client := newFakeClient(t, func(cmd []string) string {
+		atomic.AddInt32(&sets, 1)
+		return "-LOADING Redis is loading the dataset in memory\r\n"
+	})
+	if _, err := client.Set("k", "v"); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	if n := atomic.LoadInt32(&sets); n != 1 {
+		t.Errorf("test failed, expected: 1, got: %d", n)
+	}
+	// TRYAGAIN is retried by the ClusterClient only
+	if isTransient(RedisError("TRYAGAIN Multiple keys request during rehashing of slot")) {
+		t.Errorf("test failed, expected: false, got: true")
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	rc := newRedisClient(NewConnPool("127.0.0.1", "6379", 1), []Option{WithIdempotentCommands("EVALSHA")})
+	tables := []struct {
+		input    []string
+		expected bool
+	}{
+		{[]string{"GET", "k"}, true},
+		{[]string{"set", "k", "v"}, true},
+		{[]string{"SET", "k", "v", "NX"}, false},
+		{[]string{"SET", "k", "NX"}, true},
+		{[]string{"SET", "k", "v", "EX", "10", "GET"}, false},
+		{[]string{"ZADD", "z", "INCR", "1", "m"}, false},
+		{[]string{"ZADD", "z", "XX", "NX", "1", "m"}, false},
+		{[]string{"ZADD", "z", "1", "INCR"}, true},
+		{[]string{"INCR", "k"}, false},
+		{[]string{"LPUSH", "l", "v"}, false},
+		{[]string{"evalsha", "sha", "0"}, true},
+	}
+	for _, table := range tables {
+		if rc.isIdempotent(table.input) != table.expected {
+			t.Errorf("test failed, expected: %v, got: %v for %v", table.expected, !table.expected, table.input)
+		}
+	}
+}
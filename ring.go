@@ -0,0 +1,480 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RingHash is the consistent hashing algorithm distributing the keys of a Ring over its shards
+type RingHash int
+
+const (
+	// RingRendezvous sends a key to the shard with the highest hash of the shard name and the key
+	RingRendezvous RingHash = iota
+	// RingKetama places the shards at 160 points of a circle and sends a key to the first point after its hash,
+	// like libketama
+	RingKetama
+)
+
+// ErrRingShardsDown is returned by the commands of a Ring when none of its shards is up
+var ErrRingShardsDown = errors.New("all ring shards are down")
+
+// RingOptions configures a Ring
+type RingOptions struct {
+	// Shards maps the names of the shards to their host:port addresses,
+	// the keys are distributed by shard name so an address can change without moving keys
+	Shards map[string]string
+	Hash   RingHash
+	// HealthCheckInterval is how often the shards are checked with a PING, 1 second by default,
+	// a negative value disables the checks
+	HealthCheckInterval time.Duration
+	// FailureThreshold is the number of consecutive failed checks after which a shard is removed
+	// from the ring, 3 by default. A removed shard is added back after a successful check.
+	FailureThreshold int
+}
+
+// Ring is a client sharding keys over independent Redis servers, the commands of the embedded RedisClient
+// are sent to the shard of their first key, or to any shard when they have no key.
+// Mget, Mset, Del, Exists and Unlink are split into one command per shard.
+// Keys sharing a hash tag, e.g. {user1000}.following and {user1000}.followers, are on the same shard.
+// Transactions, pubsub and the other helpers holding a connection run on the first shard, by name.
+type Ring struct {
+	*RedisClient
+	opts   RingOptions
+	mu     sync.RWMutex
+	shards map[string]*ringShard
+	// distributes the keys over the shards which are up
+	hash ringHasher
+	done chan struct{}
+}
+
+type ringShard struct {
+	pool *ConnPool
+	up   bool
+	// consecutive failed health checks
+	failures int
+}
+
+// NewRing returns a client of the shards of opts
+func NewRing(opts RingOptions, clientOpts ...Option) (*Ring, error) {
+	if len(opts.Shards) == 0 {
+		return nil, errors.New("no ring shard")
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	r := &Ring{
+		opts:   opts,
+		shards: make(map[string]*ringShard),
+		done:   make(chan struct{}),
+	}
+	names := make([]string, 0, len(opts.Shards))
+	for name, addr := range opts.Shards {
+		names = append(names, name)
+		r.shards[name] = &ringShard{pool: newNodePool(addr), up: true}
+	}
+	sort.Strings(names)
+	r.rebalance()
+	r.RedisClient = newRedisClient(r.shards[names[0]].pool, clientOpts)
+	r.RedisClient.process = r.process
+	for _, shard := range r.shards {
+		shard.pool.hooks = r.hooks
+		shard.pool.logger = r.logger
+		shard.pool.breaker = newCircuitBreaker(r.breakerOpts, shard.pool)
+	}
+	// the commands are described by the first shard which answers, the other ones may be down
+	for _, name := range names {
+		if reply, err := execute(r.shards[name].pool, []string{"COMMAND"}); err == nil {
+			r.commands, _ = parseCommandInfos(reply)
+			break
+		}
+	}
+	if err := r.start(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	if opts.HealthCheckInterval > 0 {
+		go r.healthCheck()
+	}
+	return r, nil
+}
+
+// rebalance distributes the keys over the shards which are up, the lock must be held
+func (r *Ring) rebalance() {
+	var names []string
+	for name, shard := range r.shards {
+		if shard.up {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if r.opts.Hash == RingKetama {
+		r.hash = newKetama(names)
+	} else {
+		r.hash = newRendezvous(names)
+	}
+}
+
+// shardPool returns the pool of the shard of key
+func (r *Ring) shardPool(key string) (*ConnPool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.hash.get(hashTag(key))
+	if !ok {
+		return nil, ErrRingShardsDown
+	}
+	return r.shards[name].pool, nil
+}
+
+// cmdPool returns the pool of the shard of the first key of cmd, or of any shard which is up
+func (r *Ring) cmdPool(cmd []string) (*ConnPool, error) {
+	key, _ := firstKey(cmd, r.commands)
+	return r.shardPool(key)
+}
+
+func (r *Ring) process(cmd []string) (*Reply, error) {
+	pool, err := r.cmdPool(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return execute(pool, cmd)
+}
+
+// ShardName returns the name of the shard of key
+func (r *Ring) ShardName(key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.hash.get(hashTag(key))
+	if !ok {
+		return "", ErrRingShardsDown
+	}
+	return name, nil
+}
+
+// healthCheck pings the shards until Close is called, removing the failing ones from the ring
+// and adding them back when they recover
+func (r *Ring) healthCheck() {
+	ticker := time.NewTicker(r.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		r.checkShards()
+	}
+}
+
+func (r *Ring) checkShards() {
+	r.mu.RLock()
+	pools := make(map[string]*ConnPool, len(r.shards))
+	for name, shard := range r.shards {
+		pools[name] = shard.pool
+	}
+	r.mu.RUnlock()
+	healthy := make(map[string]bool, len(pools))
+	for name, pool := range pools {
+		_, err := execute(pool, []string{"PING"})
+		healthy[name] = err == nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for name, ok := range healthy {
+		shard := r.shards[name]
+		if ok {
+			shard.failures = 0
+		} else {
+			shard.failures++
+		}
+		up := ok || shard.up && shard.failures < r.opts.FailureThreshold
+		if up != shard.up {
+			shard.up = up
+			changed = true
+		}
+	}
+	if changed {
+		r.rebalance()
+	}
+}
+
+// Close stops the health checks and closes the connections to every shard
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	for _, shard := range r.shards {
+		shard.pool.Close()
+	}
+	return nil
+}
+
+// RingPipeline is a pipeline of a Ring: the commands are grouped by shard,
+// and the groups are sent to their shards in parallel
+type RingPipeline struct {
+	r    *Ring
+	cmds []*Cmd
+}
+
+// Pipeline returns a new ring pipeline, connections are only taken from the shard pools by Exec
+func (r *Ring) Pipeline() (*RingPipeline, error) {
+	return &RingPipeline{r: r}, nil
+}
+
+// AddCommand queues one command in the pipeline
+// returns the Cmd holding the result of the command after Exec
+func (rp *RingPipeline) AddCommand(command string, args ...string) *Cmd {
+	cmd := newCmd(command, args...)
+	rp.cmds = append(rp.cmds, cmd)
+	return cmd
+}
+
+// Exec sends the queued commands
+// returns the commands, in the order they were added, with their results filled in,
+// and the first error of a command, if any
+func (rp *RingPipeline) Exec() ([]*Cmd, error) {
+	cmds := rp.cmds
+	rp.cmds = nil
+	if len(rp.r.hooks) == 0 {
+		return rp.exec(cmds)
+	}
+	var res []*Cmd
+	err := processCmds(rp.r.hooks, cmds, func() error {
+		var err error
+		res, err = rp.exec(cmds)
+		return err
+	})
+	return res, err
+}
+
+func (rp *RingPipeline) exec(cmds []*Cmd) ([]*Cmd, error) {
+	groups := make(map[*ConnPool][]*Cmd)
+	for _, cmd := range cmds {
+		pool, err := rp.r.cmdPool(cmd.args)
+		if err != nil {
+			cmd.err = err
+			continue
+		}
+		groups[pool] = append(groups[pool], cmd)
+	}
+	var wg sync.WaitGroup
+	for pool, group := range groups {
+		wg.Add(1)
+		go func(pool *ConnPool, group []*Cmd) {
+			defer wg.Done()
+			execCmds(pool, group)
+		}(pool, group)
+	}
+	wg.Wait()
+	for _, cmd := range cmds {
+		if cmd.err != nil {
+			return cmds, cmd.err
+		}
+	}
+	return cmds, nil
+}
+
+// Close releases the pipeline, it holds no connection between calls of Exec
+func (rp *RingPipeline) Close() {}
+
+// shardGroups groups the indexes of keys by shard, in the order of their first key
+func (r *Ring) shardGroups(keys []string) ([][]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var groups [][]int
+	byShard := make(map[string]int)
+	for i, key := range keys {
+		name, ok := r.hash.get(hashTag(key))
+		if !ok {
+			return nil, ErrRingShardsDown
+		}
+		g, ok := byShard[name]
+		if !ok {
+			g = len(groups)
+			byShard[name] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups, nil
+}
+
+// perShard runs command once per shard of keys, with the keys of the shard, through a ring pipeline
+// returns the commands in the order of the groups of shardGroups
+func (r *Ring) perShard(command string, keys []string) ([][]int, []*Cmd, error) {
+	groups, err := r.shardGroups(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, _ := r.Pipeline()
+	for _, g := range groups {
+		args := make([]string, 0, len(g))
+		for _, i := range g {
+			args = append(args, keys[i])
+		}
+		p.AddCommand(command, args...)
+	}
+	cmds, err := p.Exec()
+	return groups, cmds, err
+}
+
+// sumPerShard runs command per shard of keys and sums the integer replies
+func (r *Ring) sumPerShard(command string, keys []string) (int64, error) {
+	_, cmds, err := r.perShard(command, keys)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.reply.integerVal
+	}
+	return n, nil
+}
+
+// Mget returns the values of all specified keys, which may be on different shards.
+// For every key that does not hold a string value or does not exist, the special value nil is returned.
+func (r *Ring) Mget(keys ...string) ([][]byte, error) {
+	groups, cmds, err := r.perShard("MGET", keys)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(keys))
+	for gi, g := range groups {
+		values := cmds[gi].reply.arrayVal
+		for j, i := range g {
+			if j < len(values) {
+				res[i] = values[j].stringVal
+			}
+		}
+	}
+	return res, nil
+}
+
+// Mset sets the given keys to their respective values, with one MSET per shard:
+// unlike on a single server the keys of different shards are not set atomically
+func (r *Ring) Mset(kvs map[string]string) error {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	groups, err := r.shardGroups(keys)
+	if err != nil {
+		return err
+	}
+	p, _ := r.Pipeline()
+	for _, g := range groups {
+		args := make([]string, 0, 2*len(g))
+		for _, i := range g {
+			args = append(args, keys[i], kvs[keys[i]])
+		}
+		p.AddCommand("MSET", args...)
+	}
+	_, err = p.Exec()
+	return err
+}
+
+// Del removes the specified keys, which may be on different shards. A key is ignored if it does not exist.
+func (r *Ring) Del(keys ...string) (int64, error) {
+	return r.sumPerShard("DEL", keys)
+}
+
+// Exists returns the number of keys existing among the given ones, a key given twice is counted twice
+func (r *Ring) Exists(keys ...string) (int64, error) {
+	return r.sumPerShard("EXISTS", keys)
+}
+
+// Unlink removes the specified keys like Del, reclaiming their memory in another thread
+func (r *Ring) Unlink(keys ...string) (int64, error) {
+	return r.sumPerShard("UNLINK", keys)
+}
+
+// ringHasher distributes keys over shards
+type ringHasher interface {
+	// get returns the shard of key, false if there is no shard
+	get(key string) (string, bool)
+}
+
+// rendezvous is the highest random weight hashing
+type rendezvous struct {
+	names []string
+}
+
+func newRendezvous(names []string) ringHasher {
+	return &rendezvous{names: names}
+}
+
+func (h *rendezvous) get(key string) (string, bool) {
+	var best string
+	var bestWeight uint64
+	for _, name := range h.names {
+		f := fnv.New64a()
+		f.Write([]byte(name))
+		f.Write([]byte{0})
+		f.Write([]byte(key))
+		if w := mix64(f.Sum64()); best == "" || w > bestWeight {
+			best, bestWeight = name, w
+		}
+	}
+	return best, best != ""
+}
+
+// mix64 is the finalizer of MurmurHash3, fnv alone does not spread the weights of similar inputs enough
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// ketamaPoints is the number of points of each shard on the circle, 4 per md5 digest
+const ketamaPoints = 160
+
+type ketama struct {
+	points []uint32
+	names  map[uint32]string
+}
+
+func newKetama(names []string) ringHasher {
+	h := &ketama{names: make(map[uint32]string)}
+	for _, name := range names {
+		for i := 0; i < ketamaPoints/4; i++ {
+			digest := md5.Sum([]byte(name + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				p := binary.LittleEndian.Uint32(digest[4*j:])
+				h.points = append(h.points, p)
+				h.names[p] = name
+			}
+		}
+	}
+	sort.Slice(h.points, func(i, j int) bool { return h.points[i] < h.points[j] })
+	return h
+}
+
+func (h *ketama) get(key string) (string, bool) {
+	if len(h.points) == 0 {
+		return "", false
+	}
+	digest := md5.Sum([]byte(key))
+	p := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= p })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.names[h.points[i]], true
+}
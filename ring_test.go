@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	newShard := func(name string) string {
+		host, port := newFakeServer(t, func(cmd []string) string {
+			if cmd[0] == "GET" {
+				return fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
+			}
+			return "+PONG\r\n"
+		})
+		return net.JoinHostPort(host, port)
+	}
+	for _, hash := range []RingHash{RingRendezvous, RingKetama} {
+		ring, err := NewRing(RingOptions{
+			Shards:              map[string]string{"a": newShard("a"), "b": newShard("b"), "dead": "127.0.0.1:1"},
+			Hash:                hash,
+			HealthCheckInterval: 10 * time.Millisecond,
+			FailureThreshold:    1,
+		})
+		if err != nil {
+			t.Fatalf("test failed, expected nil, got: %s", err)
+		}
+		seen := make(map[string]bool)
+		var deadKey string
+		for i := 0; i < 100; i++ {
+			key := "key" + strconv.Itoa(i)
+			name, _ := ring.ShardName(key)
+			seen[name] = true
+			if name == "dead" {
+				deadKey = key
+			}
+		}
+		if len(seen) != 3 {
+			t.Errorf("test failed, expected keys on 3 shards, got: %v", seen)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for name, _ := ring.ShardName(deadKey); name == "dead"; name, _ = ring.ShardName(deadKey) {
+			if time.Now().After(deadline) {
+				t.Fatalf("test failed, expected the dead shard to be removed")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		p, _ := ring.Pipeline()
+		cmds := []*Cmd{p.AddCommand("GET", deadKey), p.AddCommand("GET", "{"+deadKey+"}x")}
+		if _, err := p.Exec(); err != nil {
+			t.Fatalf("test failed, expected nil, got: %s", err)
+		}
+		v1, _ := cmds[0].Text()
+		v2, _ := cmds[1].Text()
+		if v1 == "" || v1 != v2 {
+			t.Errorf("test failed, expected keys sharing a hash tag on the same live shard, got: %s and %s", v1, v2)
+		}
+		ring.Close()
+	}
+}
+
+func TestRingMultiKey(t *testing.T) {
+	var mu sync.Mutex
+	stored := make(map[string]string)
+	newShard := func(name string) string {
+		host, port := newFakeServer(t, func(cmd []string) string {
+			switch cmd[0] {
+			case "MGET":
+				res := fmt.Sprintf("*%d\r\n", len(cmd)-1)
+				for _, key := range cmd[1:] {
+					res += bulk(name + ":" + key)
+				}
+				return res
+			case "MSET":
+				mu.Lock()
+				defer mu.Unlock()
+				for i := 1; i+1 < len(cmd); i += 2 {
+					stored[cmd[i]] = name
+				}
+				return "+OK\r\n"
+			case "DEL":
+				return fmt.Sprintf(":%d\r\n", len(cmd)-1)
+			}
+			return "+PONG\r\n"
+		})
+		return net.JoinHostPort(host, port)
+	}
+	ring, err := NewRing(RingOptions{
+		Shards:              map[string]string{"a": newShard("a"), "b": newShard("b")},
+		HealthCheckInterval: -1,
+	})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer ring.Close()
+	var keys []string
+	kvs := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		keys = append(keys, key)
+		kvs[key] = "v"
+	}
+	vals, err := ring.Mget(keys...)
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	for i, key := range keys {
+		name, _ := ring.ShardName(key)
+		if string(vals[i]) != name+":"+key {
+			t.Errorf("test failed, expected: %s, got: %s", name+":"+key, vals[i])
+		}
+	}
+	if err := ring.Mset(kvs); err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	mu.Lock()
+	for _, key := range keys {
+		if name, _ := ring.ShardName(key); stored[key] != name {
+			t.Errorf("test failed, expected %s on shard %s, got: %s", key, name, stored[key])
+		}
+	}
+	mu.Unlock()
+	if n, err := ring.Del(keys...); err != nil || n != int64(len(keys)) {
+		t.Errorf("test failed, expected: %d, got: %d (%v)", len(keys), n, err)
+	}
+}
+
+func TestRingCommandsFirstShardDown(t *testing.T) {
+	host, port := newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "COMMAND" {
+			return "*1\r\n*6\r\n$4\r\nmget\r\n:-2\r\n*0\r\n:1\r\n:-1\r\n:1\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	ring, err := NewRing(RingOptions{
+		Shards:              map[string]string{"a": "127.0.0.1:1", "b": net.JoinHostPort(host, port)},
+		HealthCheckInterval: -1,
+	})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer ring.Close()
+	if ci, ok := ring.commands["mget"]; !ok || ci.FirstKey != 1 {
+		t.Errorf("test failed, expected the commands of shard b, got: %v", ring.commands)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ScanArgs are the options of the SCAN family of commands
+type ScanArgs struct {
+	// Match only returns elements matching this glob-style pattern
+	Match string
+	// Count is a hint of how many elements are returned per call
+	Count int64
+	// Type only returns keys of this type, e.g. string, hash, zset, only used by SCAN
+	Type string
+}
+
+// scanPage runs one call of command, SCAN when key is empty, HSCAN, SSCAN or ZSCAN on key otherwise
+// returns the next cursor, "0" when the iteration is complete, and the elements of the page
+func (rc *RedisClient) scanPage(command, key, cursor string, sa ScanArgs) (string, []string, error) {
+	var args []string
+	if key != "" {
+		args = append(args, key)
+	}
+	args = append(args, cursor)
+	if sa.Match != "" {
+		args = append(args, "MATCH", sa.Match)
+	}
+	if sa.Count != 0 {
+		args = append(args, "COUNT", strconv.FormatInt(sa.Count, 10))
+	}
+	if sa.Type != "" {
+		args = append(args, "TYPE", sa.Type)
+	}
+	reply, err := rc.executeCommand(command, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(reply.arrayVal) != 2 || reply.arrayVal[0].stringVal == nil {
+		return "", nil, errors.New("malformed " + command + " reply")
+	}
+	elems := make([]string, 0, len(reply.arrayVal[1].arrayVal))
+	for _, e := range reply.arrayVal[1].arrayVal {
+		elems = append(elems, string(e.stringVal))
+	}
+	return string(reply.arrayVal[0].stringVal), elems, nil
+}
+
+// ScanIterator iterates over the elements returned by SCAN, HSCAN, SSCAN or ZSCAN, calling the command again
+// with the returned cursor until the iteration is complete.
+// HSCAN returns fields and values, and ZSCAN members and scores, one after the other.
+//
+//	it := client.ScanIterator(ctx, ScanArgs{Match: "user:*"})
+//	for it.Next() {
+//		fmt.Println(it.Val())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ScanIterator struct {
+	rc      *RedisClient
+	ctx     context.Context
+	command string
+	key     string
+	args    ScanArgs
+	cursor  string
+	// the first page has been fetched, a "0" cursor then means the iteration is complete
+	started bool
+	page    []string
+	val     string
+	err     error
+}
+
+func (rc *RedisClient) newScanIterator(ctx context.Context, command, key string, sa ScanArgs) *ScanIterator {
+	return &ScanIterator{
+		rc:      rc,
+		ctx:     ctx,
+		command: command,
+		key:     key,
+		args:    sa,
+		cursor:  "0",
+	}
+}
+
+// ScanIterator iterates over the keys of the current database
+func (rc *RedisClient) ScanIterator(ctx context.Context, sa ScanArgs) *ScanIterator {
+	return rc.newScanIterator(ctx, "SCAN", "", sa)
+}
+
+// HScanIterator iterates over the fields and values of the hash stored at key
+func (rc *RedisClient) HScanIterator(ctx context.Context, key string, sa ScanArgs) *ScanIterator {
+	sa.Type = ""
+	return rc.newScanIterator(ctx, "HSCAN", key, sa)
+}
+
+// SScanIterator iterates over the members of the set stored at key
+func (rc *RedisClient) SScanIterator(ctx context.Context, key string, sa ScanArgs) *ScanIterator {
+	sa.Type = ""
+	return rc.newScanIterator(ctx, "SSCAN", key, sa)
+}
+
+// ZScanIterator iterates over the members and scores of the sorted set stored at key
+func (rc *RedisClient) ZScanIterator(ctx context.Context, key string, sa ScanArgs) *ScanIterator {
+	sa.Type = ""
+	return rc.newScanIterator(ctx, "ZSCAN", key, sa)
+}
+
+// Next advances to the next element, fetching the next page when needed
+// returns false when the iteration is complete, has failed or its context is done
+func (it *ScanIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.started && it.cursor == "0" {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		cursor, page, err := it.rc.scanPage(it.command, it.key, it.cursor, it.args)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.started = true
+		it.cursor = cursor
+		it.page = page
+	}
+	it.val = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Val returns the current element
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *ScanIterator) Err() error {
+	return it.err
+}
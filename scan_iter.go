@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package main
+
+import "iter"
+
+// All returns the remaining elements of the iteration, to range over them
+// The error which stopped the iteration, if any, is returned by Err afterwards.
+func (it *ScanIterator) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for it.Next() {
+			if !yield(it.Val()) {
+				return
+			}
+		}
+	}
+}
+
+// Pairs returns the remaining elements two by two,
+// the fields and values of HSCAN or the members and scores of ZSCAN
+func (it *ScanIterator) Pairs() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for it.Next() {
+			first := it.Val()
+			if !it.Next() {
+				return
+			}
+			if !yield(first, it.Val()) {
+				return
+			}
+		}
+	}
+}
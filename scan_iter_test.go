@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestScanIterator(t *testing.T) {
+	pages := map[string]string{
+		"0":  "*2\r\n$2\r\n17\r\n*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+		"17": "*2\r\n$1\r\n0\r\n*1\r\n$3\r\nbaz\r\n",
+	}
+	client := newFakeClient(t, func(cmd []string) string {
+		return pages[cmd[1]]
+	})
+	it := client.ScanIterator(context.Background(), ScanArgs{Match: "*", Type: "string"})
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Val())
+	}
+	if it.Err() != nil {
+		t.Fatalf("test failed, expected nil, got: %s", it.Err())
+	}
+	if fmt.Sprint(keys) != "[foo bar baz]" {
+		t.Errorf("test failed, expected: [foo bar baz], got: %v", keys)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = client.ScanIterator(ctx, ScanArgs{})
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("test failed, expected: %s, got: %v", context.Canceled, it.Err())
+	}
+}
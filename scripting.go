@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Script is a lua script executed by its SHA1 digest, so that its source is sent to the server only once
+type Script struct {
+	src  string
+	hash string
+}
+
+// NewScript returns a Script for the lua source src, its SHA1 digest is computed locally
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{
+		src:  src,
+		hash: hex.EncodeToString(h[:]),
+	}
+}
+
+// Hash returns the SHA1 digest of the script
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+// Load loads the script into the scripts cache of the server
+func (s *Script) Load(rc *RedisClient) error {
+	_, err := rc.ScriptLoad(s.src)
+	return err
+}
+
+// Exists tells whether the script is in the scripts cache of the server
+func (s *Script) Exists(rc *RedisClient) (bool, error) {
+	res, err := rc.ScriptExists(s.hash)
+	if err != nil {
+		return false, err
+	}
+	return len(res) == 1 && res[0], nil
+}
+
+// Run executes the script with EVALSHA, keys are passed to the script as KEYS and args as ARGV
+// When the script is not in the scripts cache of the server it is executed with EVAL, which caches it.
+func (s *Script) Run(rc *RedisClient, keys []string, args ...string) (*Reply, error) {
+	reply, err := rc.EvalSha(s.hash, keys, args...)
+	if isNoScript(err) {
+		return rc.Eval(s.src, keys, args...)
+	}
+	return reply, err
+}
+
+// RunRO executes the script like Run with the read-only variants EVALSHA_RO and EVAL_RO,
+// which can be served by replicas, the script must not modify data
+func (s *Script) RunRO(rc *RedisClient, keys []string, args ...string) (*Reply, error) {
+	reply, err := rc.EvalShaRO(s.hash, keys, args...)
+	if isNoScript(err) {
+		return rc.EvalRO(s.src, keys, args...)
+	}
+	return reply, err
+}
+
+func isNoScript(err error) bool {
+	rerr, ok := err.(RedisError)
+	return ok && strings.HasPrefix(string(rerr), "NOSCRIPT")
+}
+
+// evalArgs builds the arguments of the EVAL family of commands
+func evalArgs(script string, keys []string, args []string) []string {
+	res := make([]string, 0, 2+len(keys)+len(args))
+	res = append(res, script, strconv.Itoa(len(keys)))
+	res = append(res, keys...)
+	return append(res, args...)
+}
+
+// Eval executes a lua script, keys are passed to the script as KEYS and args as ARGV
+func (rc *RedisClient) Eval(script string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("EVAL", evalArgs(script, keys, args)...)
+}
+
+// EvalSha executes a script cached on the server by its SHA1 digest
+// returns an error starting with NOSCRIPT when the script is not cached
+func (rc *RedisClient) EvalSha(sha1 string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("EVALSHA", evalArgs(sha1, keys, args)...)
+}
+
+// EvalRO is the read-only variant of Eval
+func (rc *RedisClient) EvalRO(script string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("EVAL_RO", evalArgs(script, keys, args)...)
+}
+
+// EvalShaRO is the read-only variant of EvalSha
+func (rc *RedisClient) EvalShaRO(sha1 string, keys []string, args ...string) (*Reply, error) {
+	return rc.executeCommand("EVALSHA_RO", evalArgs(sha1, keys, args)...)
+}
+
+// ScriptExists tells, for each SHA1 digest, whether the script is in the scripts cache
+func (rc *RedisClient) ScriptExists(sha1s ...string) ([]bool, error) {
+	reply, err := rc.executeCommand("SCRIPT", append([]string{"EXISTS"}, sha1s...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		res = append(res, r.integerVal == 1)
+	}
+	return res, nil
+}
+
+// ScriptFlush flushes the scripts cache, asynchronously if async is true
+func (rc *RedisClient) ScriptFlush(async bool) error {
+	_, err := rc.executeCommand("SCRIPT", append([]string{"FLUSH"}, flushArgs(async)...)...)
+	return err
+}
+
+// AddScript queues the execution of a script with EVALSHA
+// When the server replies NOSCRIPT, Exec loads the script and sends its EVALSHA again in a second round trip,
+// after the other queued commands.
+func (p *Pipeline) AddScript(s *Script, keys []string, args ...string) {
+	if p.scripts == nil {
+		p.scripts = make(map[string]*Script)
+	}
+	p.scripts[s.hash] = s
+	p.AddCommand("EVALSHA", evalArgs(s.hash, keys, args)...)
+}
+
+// AddScript queues the execution of a script in the transaction
+// The script is queued with EVALSHA once a transaction of the pool has run it, and with EVAL before,
+// which caches it: a command of a transaction can not be sent again after a NOSCRIPT reply
+// since the other commands have run.
+func (tx *Transaction) AddScript(s *Script, keys []string, args ...string) error {
+	index := tx.queued
+	cmd := scriptCommand(tx.pool, s, keys, args)
+	if err := tx.AddCommand(cmd[0], cmd[1:]...); err != nil {
+		return err
+	}
+	tx.scripts = append(tx.scripts, queuedScript{index: index, hash: s.hash})
+	return nil
+}
+
+// AddScript queues the execution of a script in the transaction, like Transaction.AddScript
+func (tp *TxPipeline) AddScript(s *Script, keys []string, args ...string) *Cmd {
+	args = scriptCommand(tp.pool, s, keys, args)
+	cmd := tp.AddCommand(args[0], args[1:]...)
+	tp.scripts = append(tp.scripts, queuedScript{index: len(tp.cmds) - 1, hash: s.hash})
+	return cmd
+}
+
+// queuedScript is a script queued in a transaction at index
+type queuedScript struct {
+	index int
+	hash  string
+}
+
+// scriptCommand returns the EVALSHA of s if the server of pool is known to have cached it, its EVAL otherwise
+func scriptCommand(pool *ConnPool, s *Script, keys []string, args []string) []string {
+	if pool.scriptCached(s.hash) {
+		return append([]string{"EVALSHA"}, evalArgs(s.hash, keys, args)...)
+	}
+	return append([]string{"EVAL"}, evalArgs(s.src, keys, args)...)
+}
+
+// trackScripts records which scripts are cached by the server from the results of a transaction,
+// errs being the errors of the queued commands
+func trackScripts(pool *ConnPool, scripts []queuedScript, errs []error) {
+	for _, s := range scripts {
+		if s.index < len(errs) {
+			// any other outcome means the script was found and run
+			pool.setScriptCached(s.hash, !isNoScript(errs[s.index]))
+		}
+	}
+}
+
+// scriptOf returns the script of cmd when it is the EVALSHA of one of scripts
+func scriptOf(scripts map[string]*Script, cmd []string) *Script {
+	if len(cmd) < 2 || !strings.EqualFold(cmd[0], "EVALSHA") {
+		return nil
+	}
+	return scripts[cmd[1]]
+}
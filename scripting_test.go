@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	s := NewScript("return 1")
+	expected := "e0e1f9fabfc9d4800c877a703b823ac0578ff8db"
+	if s.Hash() != expected {
+		t.Errorf("test failed, expected: %s, got: %s", expected, s.Hash())
+	}
+
+	// the EVALSHA failing with NOSCRIPT is sent again after SCRIPT LOAD, whose reply is not returned
+	p := &Pipeline{
+		conn: newTestConn("-NOSCRIPT No matching script\r\n:2\r\n$40\r\n" + expected + "\r\n:1\r\n"),
+		pool: NewConnPool("127.0.0.1", "6379", 1),
+	}
+	p.AddScript(s, nil)
+	p.AddCommand("INCR", "x")
+	r, err := p.Exec()
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if len(r) != 2 || r[0].integerVal != 1 || r[1].integerVal != 2 {
+		t.Errorf("test failed, expected: [1 2], got: %v", r)
+	}
+
+	// a transaction sends EVAL until one has run the script, then EVALSHA
+	pool := NewConnPool("127.0.0.1", "6379", 1)
+	tp := &TxPipeline{conn: newTestConn("+OK\r\n+QUEUED\r\n*1\r\n:1\r\n"), pool: pool}
+	if cmd := tp.AddScript(s, nil); cmd.args[0] != "EVAL" {
+		t.Errorf("test failed, expected: EVAL, got: %s", cmd.args[0])
+	}
+	if _, err := tp.Exec(); err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	tp.conn = newTestConn("+OK\r\n+QUEUED\r\n*1\r\n-NOSCRIPT No matching script\r\n")
+	if cmd := tp.AddScript(s, nil); cmd.args[0] != "EVALSHA" || cmd.args[1] != expected {
+		t.Errorf("test failed, expected: EVALSHA %s, got: %v", expected, cmd.args)
+	}
+	tp.Exec()
+	// the script was flushed from the server
+	if cmd := tp.AddScript(s, nil); cmd.args[0] != "EVAL" {
+		t.Errorf("test failed, expected: EVAL, got: %s", cmd.args[0])
+	}
+}
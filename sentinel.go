@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// switchMasterChannel is the channel on which sentinels announce failovers,
+// with messages of the form "<master name> <old ip> <old port> <new ip> <new port>"
+const switchMasterChannel = "+switch-master"
+
+// sentinelTimeout bounds the dials to the sentinels and the replies to their commands
+const sentinelTimeout = 3 * time.Second
+
+// sentinelPingInterval is how long the subscription to switchMasterChannel can stay silent before it is
+// checked with a PING, a sentinel not answering within another interval is given up
+var sentinelPingInterval = time.Second
+
+// NewFailoverClient returns a Redis client connected to the master named masterName, as known by the sentinels
+// at sentinelAddrs, host:port addresses tried in order.
+// The client follows failovers announced by the sentinels: the connections to the previous master are closed
+// and the next commands are sent to the new one.
+func NewFailoverClient(masterName string, sentinelAddrs []string, opts ...Option) (*RedisClient, error) {
+	if len(sentinelAddrs) == 0 {
+		return nil, errors.New("no sentinel address")
+	}
+	sw := &sentinelWatcher{
+		masterName:   masterName,
+		addrs:        sentinelAddrs,
+		pingInterval: sentinelPingInterval,
+		done:         make(chan struct{}),
+	}
+	host, port, err := sw.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+	sw.pool = NewConnPool(host, port, 10*runtime.NumCPU())
+	rc := newRedisClient(sw.pool, opts)
+	if rc.replicas != nil {
+		sw.replicas = rc.replicas
+		sw.refreshReplicas()
+	}
+	if err := rc.start(); err != nil {
+		return nil, err
+	}
+	rc.sentinel = sw
+	go sw.run()
+	return rc, nil
+}
+
+// sentinelWatcher points a pool at the master elected by the sentinels
+type sentinelWatcher struct {
+	masterName string
+	addrs      []string
+	// index in addrs of the sentinel subscribed to first
+	next         int
+	pingInterval time.Duration
+	pool         *ConnPool
+	// receives the replicas of the master when reads are sent to replicas
+	replicas *replicaRouter
+	done     chan struct{}
+	mu       sync.Mutex
+	// the connection subscribed to switchMasterChannel
+	conn    Conn
+	hasConn bool
+	stopped bool
+}
+
+// masterAddr asks the sentinels, in order, for the address of the master
+func (sw *sentinelWatcher) masterAddr() (string, string, error) {
+	var lastErr error
+	for _, addr := range sw.addrs {
+		host, port, err := querySentinel(addr, sw.masterName)
+		if err == nil {
+			return host, port, nil
+		}
+		lastErr = err
+	}
+	return "", "", lastErr
+}
+
+// sentinelCommand runs a SENTINEL subcommand on the sentinel at addr
+func sentinelCommand(addr string, args ...string) (*Reply, error) {
+	c, err := dialConn(addr, sentinelTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	if err := c.SendCommand(append([]string{"SENTINEL"}, args...)...); err != nil {
+		return nil, err
+	}
+	if err := c.setReadDeadline(time.Now().Add(sentinelTimeout)); err != nil {
+		return nil, err
+	}
+	return c.ReadResp()
+}
+
+func querySentinel(addr, masterName string) (string, string, error) {
+	reply, err := sentinelCommand(addr, "GET-MASTER-ADDR-BY-NAME", masterName)
+	if err != nil {
+		return "", "", err
+	}
+	if reply.arrayVal == nil {
+		return "", "", errors.New("sentinel " + addr + " does not know master " + masterName)
+	}
+	if len(reply.arrayVal) != 2 {
+		return "", "", errors.New("malformed SENTINEL GET-MASTER-ADDR-BY-NAME reply")
+	}
+	return string(reply.arrayVal[0].stringVal), string(reply.arrayVal[1].stringVal), nil
+}
+
+// refresh points the pool at the master known by the sentinels
+func (sw *sentinelWatcher) refresh() {
+	if host, port, err := sw.masterAddr(); err == nil {
+		sw.pool.setAddr(host, port)
+	}
+	sw.refreshReplicas()
+}
+
+// refreshReplicas asks the sentinels for the replicas of the master, skipping the ones down or disconnected
+func (sw *sentinelWatcher) refreshReplicas() {
+	if sw.replicas == nil {
+		return
+	}
+	for _, addr := range sw.addrs {
+		reply, err := sentinelCommand(addr, "REPLICAS", sw.masterName)
+		if err != nil {
+			continue
+		}
+		var replicas []string
+		for _, r := range reply.arrayVal {
+			m := r.mapVal()
+			ip, port, flags := m["ip"], m["port"], m["flags"]
+			if ip == nil || port == nil {
+				continue
+			}
+			if flags != nil {
+				f := string(flags.stringVal)
+				if strings.Contains(f, "s_down") || strings.Contains(f, "o_down") || strings.Contains(f, "disconnected") {
+					continue
+				}
+			}
+			replicas = append(replicas, net.JoinHostPort(string(ip.stringVal), string(port.stringVal)))
+		}
+		sw.replicas.setAddrs(replicas)
+		return
+	}
+}
+
+// run listens to the failovers until stop is called, reconnecting to the sentinels when the connection fails
+func (sw *sentinelWatcher) run() {
+	backoff := 100 * time.Millisecond
+	for {
+		if sw.listen() {
+			backoff = 100 * time.Millisecond
+		}
+		select {
+		case <-sw.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// listen subscribes to switchMasterChannel on the first reachable sentinel and follows the failovers
+// until the connection fails or the sentinel stops answering PING, the next subscription starts
+// with the following sentinel
+// returns whether the subscription succeeded
+func (sw *sentinelWatcher) listen() bool {
+	c, i, ok := sw.subscribe()
+	if !ok {
+		return false
+	}
+	defer sw.release(c)
+	sw.next = i + 1
+	// the master may have changed before the subscription
+	sw.refresh()
+	pinged := false
+	for {
+		if err := c.setReadDeadline(time.Now().Add(sw.pingInterval)); err != nil {
+			return true
+		}
+		reply, err := c.ReadResp()
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() && !pinged {
+			// a silent connection may be half-open, the sentinel must answer the PING
+			if err := c.SendCommand("PING"); err != nil {
+				return true
+			}
+			pinged = true
+			continue
+		}
+		if err != nil {
+			return true
+		}
+		pinged = false
+		if len(reply.arrayVal) != 3 || string(reply.arrayVal[0].stringVal) != "message" {
+			continue
+		}
+		fields := strings.Fields(string(reply.arrayVal[2].stringVal))
+		if len(fields) == 5 && fields[0] == sw.masterName {
+			sw.pool.setAddr(fields[3], fields[4])
+			// the new master was one of the replicas
+			sw.refreshReplicas()
+		}
+	}
+}
+
+// subscribe subscribes to switchMasterChannel on the first reachable sentinel, starting from sw.next
+// returns the connection and the index of the sentinel
+func (sw *sentinelWatcher) subscribe() (Conn, int, bool) {
+	for n := 0; n < len(sw.addrs); n++ {
+		i := (sw.next + n) % len(sw.addrs)
+		c, err := dialConn(sw.addrs[i], sentinelTimeout)
+		if err != nil {
+			continue
+		}
+		if !sw.track(c) {
+			c.close()
+			return Conn{}, 0, false
+		}
+		if err := c.SendCommand("SUBSCRIBE", switchMasterChannel); err == nil {
+			c.setReadDeadline(time.Now().Add(sentinelTimeout))
+			if _, err := c.ReadResp(); err == nil {
+				return c, i, true
+			}
+		}
+		sw.release(c)
+	}
+	return Conn{}, 0, false
+}
+
+// track records c as the connection to close on stop
+// returns false if the watcher is already stopped
+func (sw *sentinelWatcher) track(c Conn) bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.stopped {
+		return false
+	}
+	sw.conn = c
+	sw.hasConn = true
+	return true
+}
+
+func (sw *sentinelWatcher) release(c Conn) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.hasConn = false
+	c.close()
+}
+
+func (sw *sentinelWatcher) stop() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.stopped {
+		return
+	}
+	sw.stopped = true
+	close(sw.done)
+	if sw.hasConn {
+		sw.conn.close()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailoverClient(t *testing.T) {
+	newMaster := func(name string) (string, string) {
+		return newFakeServer(t, func(cmd []string) string {
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(name), name)
+		})
+	}
+	host1, port1 := newMaster("m1")
+	host2, port2 := newMaster("m2")
+	// the sentinel keeps returning the first master, the client only learns about the failover from +switch-master
+	switchMaster := fmt.Sprintf("mymaster %s %s %s %s", host1, port1, host2, port2)
+	sentinelHost, sentinelPort := newFakeServer(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "SENTINEL":
+			return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host1), host1, len(port1), port1)
+		case "SUBSCRIBE":
+			return "*3\r\n$9\r\nsubscribe\r\n$14\r\n+switch-master\r\n:1\r\n" +
+				fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$%d\r\n%s\r\n", len(switchMaster), switchMaster)
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client, err := NewFailoverClient("mymaster", []string{"127.0.0.1:1", net.JoinHostPort(sentinelHost, sentinelPort)})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		val, err := client.Get("k")
+		if err == nil && string(val) == "m2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("test failed, expected: m2, got: %s (%v)", val, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := NewFailoverClient("other", nil); err == nil {
+		t.Errorf("test failed, expected not nil, got: nil")
+	}
+}
+
+func TestFailoverClientSilentSentinel(t *testing.T) {
+	defer func(d time.Duration) { sentinelPingInterval = d }(sentinelPingInterval)
+	sentinelPingInterval = 20 * time.Millisecond
+	newMaster := func(name string) (string, string) {
+		return newFakeServer(t, func(cmd []string) string {
+			return bulk(name)
+		})
+	}
+	host1, port1 := newMaster("m1")
+	host2, port2 := newMaster("m2")
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	var silent int32
+	// the first sentinel disappears after the subscription: it does not answer PING, new connections fail
+	sentinel1Host, sentinel1Port := newFakeServer(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "SENTINEL":
+			if atomic.LoadInt32(&silent) == 1 {
+				return ""
+			}
+			return "*2\r\n" + bulk(host1) + bulk(port1)
+		case "SUBSCRIBE":
+			return "*3\r\n" + bulk("subscribe") + bulk(switchMasterChannel) + ":1\r\n"
+		}
+		atomic.StoreInt32(&silent, 1)
+		<-stop
+		return ""
+	})
+	sentinel2Host, sentinel2Port := newFakeServer(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "SENTINEL":
+			return "*2\r\n" + bulk(host2) + bulk(port2)
+		case "SUBSCRIBE":
+			return "*3\r\n" + bulk("subscribe") + bulk(switchMasterChannel) + ":1\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	client, err := NewFailoverClient("mymaster", []string{
+		net.JoinHostPort(sentinel1Host, sentinel1Port),
+		net.JoinHostPort(sentinel2Host, sentinel2Port),
+	})
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	defer client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		val, err := client.Get("k")
+		if err == nil && string(val) == "m2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("test failed, expected: m2, got: %s (%v)", val, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ping the server
+// returns PONG, or msg if it is given
+func (rc *RedisClient) Ping(msg ...string) (string, error) {
+	reply, err := rc.executeCommand("PING", msg...)
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// Echo returns msg
+func (rc *RedisClient) Echo(msg string) (string, error) {
+	reply, err := rc.executeCommand("ECHO", msg)
+	if err != nil {
+		return "", err
+	}
+	return string(reply.stringVal), nil
+}
+
+// ServerInfo is the result of INFO, indexed by lower-case section name, e.g. server, clients, memory, keyspace
+type ServerInfo map[string]InfoSection
+
+// InfoSection holds the fields of a section of INFO
+type InfoSection map[string]string
+
+// Get returns the raw value of a field, empty if it does not exist
+func (s InfoSection) Get(key string) string {
+	return s[key]
+}
+
+// Int returns the value of a field as an integer
+// returns false if the field does not exist or is not an integer
+func (s InfoSection) Int(key string) (int64, bool) {
+	n, err := strconv.ParseInt(s[key], 10, 64)
+	return n, err == nil
+}
+
+// Float returns the value of a field as a floating point number
+// returns false if the field does not exist or is not a number
+func (s InfoSection) Float(key string) (float64, bool) {
+	f, err := strconv.ParseFloat(s[key], 64)
+	return f, err == nil
+}
+
+// Fields splits a value made of comma separated key=value pairs,
+// such as the databases of the keyspace section or the command statistics
+func (s InfoSection) Fields(key string) map[string]string {
+	v, ok := s[key]
+	if !ok {
+		return nil
+	}
+	return splitFields(v, ",")
+}
+
+// splitFields splits key=value pairs separated by sep
+func splitFields(s, sep string) map[string]string {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(s, sep) {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Info returns information and statistics about the server, for the given sections or the default ones
+func (rc *RedisClient) Info(sections ...string) (ServerInfo, error) {
+	reply, err := rc.executeCommand("INFO", sections...)
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(string(reply.stringVal)), nil
+}
+
+// parseInfo parses the text returned by INFO: "# Section" headers followed by "key:value" lines
+func parseInfo(text string) ServerInfo {
+	info := make(ServerInfo)
+	var section InfoSection
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			section = make(InfoSection)
+			info[strings.ToLower(strings.TrimSpace(line[1:]))] = section
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if section == nil {
+			section = make(InfoSection)
+			info[""] = section
+		}
+		section[k] = v
+	}
+	return info
+}
+
+// DBSize returns the number of keys in the current database
+func (rc *RedisClient) DBSize() (int64, error) {
+	reply, err := rc.executeCommand("DBSIZE")
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// flushArgs returns the modifier of the FLUSH commands, none for a synchronous flush:
+// SYNC only exists from Redis 6.2 and is the default
+func flushArgs(async bool) []string {
+	if async {
+		return []string{"ASYNC"}
+	}
+	return nil
+}
+
+// FlushDB deletes all the keys of the current database, asynchronously if async is true
+func (rc *RedisClient) FlushDB(async bool) error {
+	_, err := rc.executeCommand("FLUSHDB", flushArgs(async)...)
+	return err
+}
+
+// FlushAll deletes all the keys of all the databases, asynchronously if async is true
+func (rc *RedisClient) FlushAll(async bool) error {
+	_, err := rc.executeCommand("FLUSHALL", flushArgs(async)...)
+	return err
+}
+
+// ConfigGet returns the configuration parameters matching pattern
+func (rc *RedisClient) ConfigGet(pattern string) (map[string]string, error) {
+	reply, err := rc.executeCommand("CONFIG", "GET", pattern)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(reply.arrayVal)/2)
+	for k, v := range reply.mapVal() {
+		res[k] = string(v.stringVal)
+	}
+	return res, nil
+}
+
+// ConfigSet sets a configuration parameter
+func (rc *RedisClient) ConfigSet(parameter, value string) error {
+	_, err := rc.executeCommand("CONFIG", "SET", parameter, value)
+	return err
+}
+
+// ConfigRewrite rewrites the configuration file with the running configuration
+func (rc *RedisClient) ConfigRewrite() error {
+	_, err := rc.executeCommand("CONFIG", "REWRITE")
+	return err
+}
+
+// ConfigResetStat resets the statistics reported by INFO and LATENCY HISTOGRAM
+func (rc *RedisClient) ConfigResetStat() error {
+	_, err := rc.executeCommand("CONFIG", "RESETSTAT")
+	return err
+}
+
+// ClientInfo describes a client connection, as listed by CLIENT LIST
+type ClientInfo struct {
+	ID    int64
+	Addr  string
+	LAddr string
+	Name  string
+	Age   time.Duration
+	Idle  time.Duration
+	Flags string
+	DB    int
+	// Sub, PSub and SSub are the number of channel, pattern and shard channel subscriptions
+	Sub  int
+	PSub int
+	SSub int
+	// Multi is the number of commands queued in MULTI, -1 outside a transaction
+	Multi int
+	// Cmd is the last command played
+	Cmd  string
+	User string
+	// Fields holds every field of the client, including the ones without a dedicated member
+	Fields map[string]string
+}
+
+// parseClientInfo parses one line of CLIENT LIST, made of space separated key=value pairs
+func parseClientInfo(line string) *ClientInfo {
+	fields := splitFields(strings.TrimSpace(line), " ")
+	atoi := func(k string) int {
+		n, _ := strconv.Atoi(fields[k])
+		return n
+	}
+	id, _ := strconv.ParseInt(fields["id"], 10, 64)
+	return &ClientInfo{
+		ID:     id,
+		Addr:   fields["addr"],
+		LAddr:  fields["laddr"],
+		Name:   fields["name"],
+		Age:    time.Duration(atoi("age")) * time.Second,
+		Idle:   time.Duration(atoi("idle")) * time.Second,
+		Flags:  fields["flags"],
+		DB:     atoi("db"),
+		Sub:    atoi("sub"),
+		PSub:   atoi("psub"),
+		SSub:   atoi("ssub"),
+		Multi:  atoi("multi"),
+		Cmd:    fields["cmd"],
+		User:   fields["user"],
+		Fields: fields,
+	}
+}
+
+// ClientList returns the client connections of the server
+func (rc *RedisClient) ClientList() ([]*ClientInfo, error) {
+	reply, err := rc.executeCommand("CLIENT", "LIST")
+	if err != nil {
+		return nil, err
+	}
+	var res []*ClientInfo
+	for _, line := range strings.Split(string(reply.stringVal), "\n") {
+		if strings.TrimSpace(line) != "" {
+			res = append(res, parseClientInfo(line))
+		}
+	}
+	return res, nil
+}
+
+// ClientInfo returns the connection of the client executing the command
+func (rc *RedisClient) ClientInfo() (*ClientInfo, error) {
+	reply, err := rc.executeCommand("CLIENT", "INFO")
+	if err != nil {
+		return nil, err
+	}
+	return parseClientInfo(string(reply.stringVal)), nil
+}
+
+// ClientID returns the id of the connection executing the command
+func (rc *RedisClient) ClientID() (int64, error) {
+	reply, err := rc.executeCommand("CLIENT", "ID")
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// ClientKillArgs selects the connections closed by ClientKill, every non-zero field must match
+type ClientKillArgs struct {
+	ID    int64
+	Addr  string
+	LAddr string
+	User  string
+	// Type is normal, master, replica or pubsub
+	Type string
+	// KillMe closes the connection executing the command too if it matches, it is skipped by default
+	KillMe bool
+}
+
+// ClientKill closes the client connections matching the filters, at least one filter must be set
+// returns the number of closed connections
+func (rc *RedisClient) ClientKill(ca ClientKillArgs) (int64, error) {
+	if ca.ID == 0 && ca.Addr == "" && ca.LAddr == "" && ca.User == "" && ca.Type == "" {
+		return 0, errors.New("no client kill filter")
+	}
+	args := []string{"KILL"}
+	if ca.ID != 0 {
+		args = append(args, "ID", strconv.FormatInt(ca.ID, 10))
+	}
+	if ca.Addr != "" {
+		args = append(args, "ADDR", ca.Addr)
+	}
+	if ca.LAddr != "" {
+		args = append(args, "LADDR", ca.LAddr)
+	}
+	if ca.User != "" {
+		args = append(args, "USER", ca.User)
+	}
+	if ca.Type != "" {
+		args = append(args, "TYPE", ca.Type)
+	}
+	if ca.KillMe {
+		args = append(args, "SKIPME", "no")
+	}
+	reply, err := rc.executeCommand("CLIENT", args...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// ClientPause suspends the clients for d, or only their write commands if writeOnly is true
+func (rc *RedisClient) ClientPause(d time.Duration, writeOnly bool) error {
+	mode := "ALL"
+	if writeOnly {
+		mode = "WRITE"
+	}
+	_, err := rc.executeCommand("CLIENT", "PAUSE", strconv.FormatInt(d.Milliseconds(), 10), mode)
+	return err
+}
+
+// ClientUnpause resumes the clients paused by ClientPause
+func (rc *RedisClient) ClientUnpause() error {
+	_, err := rc.executeCommand("CLIENT", "UNPAUSE")
+	return err
+}
+
+// SlowLogEntry is a command logged by the slow log
+type SlowLogEntry struct {
+	ID         int64
+	Time       time.Time
+	Duration   time.Duration
+	Args       []string
+	ClientAddr string
+	ClientName string
+}
+
+// SlowLogGet returns the n most recent entries of the slow log, or the default number if n is negative
+func (rc *RedisClient) SlowLogGet(n int) ([]SlowLogEntry, error) {
+	args := []string{"GET"}
+	if n >= 0 {
+		args = append(args, strconv.Itoa(n))
+	}
+	reply, err := rc.executeCommand("SLOWLOG", args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]SlowLogEntry, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		if len(r.arrayVal) < 4 {
+			return nil, errors.New("malformed SLOWLOG GET reply")
+		}
+		e := SlowLogEntry{
+			ID:       r.arrayVal[0].integerVal,
+			Time:     time.Unix(r.arrayVal[1].integerVal, 0),
+			Duration: time.Duration(r.arrayVal[2].integerVal) * time.Microsecond,
+		}
+		for _, arg := range r.arrayVal[3].arrayVal {
+			e.Args = append(e.Args, string(arg.stringVal))
+		}
+		// since redis 4
+		if len(r.arrayVal) >= 6 {
+			e.ClientAddr = string(r.arrayVal[4].stringVal)
+			e.ClientName = string(r.arrayVal[5].stringVal)
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// SlowLogLen returns the number of entries of the slow log
+func (rc *RedisClient) SlowLogLen() (int64, error) {
+	reply, err := rc.executeCommand("SLOWLOG", "LEN")
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// SlowLogReset empties the slow log
+func (rc *RedisClient) SlowLogReset() error {
+	_, err := rc.executeCommand("SLOWLOG", "RESET")
+	return err
+}
+
+// LatencyEvent is the latest latency spike of an event, as reported by LATENCY LATEST
+type LatencyEvent struct {
+	Event  string
+	Time   time.Time
+	Latest time.Duration
+	Max    time.Duration
+}
+
+// LatencyLatest returns the latest latency spike of every event monitored by the latency monitor
+func (rc *RedisClient) LatencyLatest() ([]LatencyEvent, error) {
+	reply, err := rc.executeCommand("LATENCY", "LATEST")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]LatencyEvent, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		if len(r.arrayVal) < 4 {
+			return nil, errors.New("malformed LATENCY LATEST reply")
+		}
+		res = append(res, LatencyEvent{
+			Event:  string(r.arrayVal[0].stringVal),
+			Time:   time.Unix(r.arrayVal[1].integerVal, 0),
+			Latest: time.Duration(r.arrayVal[2].integerVal) * time.Millisecond,
+			Max:    time.Duration(r.arrayVal[3].integerVal) * time.Millisecond,
+		})
+	}
+	return res, nil
+}
+
+// LatencySample is a latency spike of an event
+type LatencySample struct {
+	Time    time.Time
+	Latency time.Duration
+}
+
+// LatencyHistory returns the latency spikes recorded for event
+func (rc *RedisClient) LatencyHistory(event string) ([]LatencySample, error) {
+	reply, err := rc.executeCommand("LATENCY", "HISTORY", event)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]LatencySample, 0, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		if len(r.arrayVal) < 2 {
+			return nil, errors.New("malformed LATENCY HISTORY reply")
+		}
+		res = append(res, LatencySample{
+			Time:    time.Unix(r.arrayVal[0].integerVal, 0),
+			Latency: time.Duration(r.arrayVal[1].integerVal) * time.Millisecond,
+		})
+	}
+	return res, nil
+}
+
+// LatencyReset resets the latency spikes of the given events, or of all of them
+// returns the number of reset events
+func (rc *RedisClient) LatencyReset(events ...string) (int64, error) {
+	reply, err := rc.executeCommand("LATENCY", append([]string{"RESET"}, events...)...)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// MemoryUsage returns the number of bytes used by key and its value
+// returns 0 if the key does not exist
+func (rc *RedisClient) MemoryUsage(key string) (int64, error) {
+	reply, err := rc.executeCommand("MEMORY", "USAGE", key)
+	if err != nil {
+		return 0, err
+	}
+	return reply.integerVal, nil
+}
+
+// MemoryStats returns the memory usage statistics of the server
+// Nested statistics, such as the ones of each database, are flattened with dotted keys, e.g. db.0.overhead.hashtable.main
+func (rc *RedisClient) MemoryStats() (map[string]string, error) {
+	reply, err := rc.executeCommand("MEMORY", "STATS")
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string)
+	flattenStats(res, "", reply)
+	return res, nil
+}
+
+func flattenStats(res map[string]string, prefix string, reply *Reply) {
+	for k, v := range reply.mapVal() {
+		switch {
+		case v.arrayVal != nil:
+			flattenStats(res, prefix+k+".", v)
+		case v.stringVal != nil:
+			res[prefix+k] = string(v.stringVal)
+		default:
+			res[prefix+k] = strconv.FormatInt(v.integerVal, 10)
+		}
+	}
+}
+
+// Time returns the current time of the server
+func (rc *RedisClient) Time() (time.Time, error) {
+	reply, err := rc.executeCommand("TIME")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(reply.arrayVal) != 2 {
+		return time.Time{}, errors.New("malformed TIME reply")
+	}
+	sec, err := strconv.ParseInt(string(reply.arrayVal[0].stringVal), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	usec, err := strconv.ParseInt(string(reply.arrayVal[1].stringVal), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond)), nil
+}
+
+// LastSave returns the time of the last successful save to disk
+func (rc *RedisClient) LastSave() (time.Time, error) {
+	reply, err := rc.executeCommand("LASTSAVE")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(reply.integerVal, 0), nil
+}
+
+// BgSave saves the dataset to disk in the background
+func (rc *RedisClient) BgSave() error {
+	_, err := rc.executeCommand("BGSAVE")
+	return err
+}
+
+// BgRewriteAOF rewrites the append-only file in the background
+func (rc *RedisClient) BgRewriteAOF() error {
+	_, err := rc.executeCommand("BGREWRITEAOF")
+	return err
+}
+
+// CommandInfo describes a command of the server, as returned by COMMAND
+type CommandInfo struct {
+	Name string
+	// Arity is the number of arguments, command name included, or the minimum number when negative
+	Arity int64
+	// Flags such as write, readonly, denyoom, fast
+	Flags []string
+	// FirstKey, LastKey and Step locate the keys in the arguments, LastKey is negative when counted from the end
+	FirstKey      int64
+	LastKey       int64
+	Step          int64
+	ACLCategories []string
+}
+
+// HasFlag tells whether the command has flag
+func (ci *CommandInfo) HasFlag(flag string) bool {
+	for _, f := range ci.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Command returns the description of every command of the server, indexed by lower-case name
+func (rc *RedisClient) Command() (map[string]*CommandInfo, error) {
+	reply, err := rc.executeCommand("COMMAND")
+	if err != nil {
+		return nil, err
+	}
+	return parseCommandInfos(reply)
+}
+
+func parseCommandInfos(reply *Reply) (map[string]*CommandInfo, error) {
+	res := make(map[string]*CommandInfo, len(reply.arrayVal))
+	for _, r := range reply.arrayVal {
+		if len(r.arrayVal) < 6 {
+			return nil, errors.New("malformed COMMAND reply")
+		}
+		ci := &CommandInfo{
+			Name:     strings.ToLower(string(r.arrayVal[0].stringVal)),
+			Arity:    r.arrayVal[1].integerVal,
+			FirstKey: r.arrayVal[3].integerVal,
+			LastKey:  r.arrayVal[4].integerVal,
+			Step:     r.arrayVal[5].integerVal,
+		}
+		for _, f := range r.arrayVal[2].arrayVal {
+			ci.Flags = append(ci.Flags, string(f.stringVal))
+		}
+		// since redis 6
+		if len(r.arrayVal) >= 7 {
+			for _, c := range r.arrayVal[6].arrayVal {
+				ci.ACLCategories = append(ci.ACLCategories, string(c.stringVal))
+			}
+		}
+		res[ci.Name] = ci
+	}
+	return res, nil
+}
+
+// CommandDoc is the documentation of a command, as returned by COMMAND DOCS
+type CommandDoc struct {
+	Summary    string
+	Since      string
+	Group      string
+	Complexity string
+}
+
+// CommandDocs returns the documentation of the given commands, or of every command, indexed by lower-case name
+func (rc *RedisClient) CommandDocs(commands ...string) (map[string]*CommandDoc, error) {
+	reply, err := rc.executeCommand("COMMAND", append([]string{"DOCS"}, commands...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]*CommandDoc, len(reply.arrayVal)/2)
+	for name, r := range reply.mapVal() {
+		m := r.mapVal()
+		doc := &CommandDoc{}
+		if v, ok := m["summary"]; ok {
+			doc.Summary = string(v.stringVal)
+		}
+		if v, ok := m["since"]; ok {
+			doc.Since = string(v.stringVal)
+		}
+		if v, ok := m["group"]; ok {
+			doc.Group = string(v.stringVal)
+		}
+		if v, ok := m["complexity"]; ok {
+			doc.Complexity = string(v.stringVal)
+		}
+		res[strings.ToLower(name)] = doc
+	}
+	return res, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo("# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:42\r\n\r\n# Keyspace\r\ndb0:keys=3,expires=1,avg_ttl=0\r\n")
+	if v := info["server"].Get("redis_version"); v != "7.2.4" {
+		t.Errorf("test failed, expected: %s, got: %s", "7.2.4", v)
+	}
+	if n, ok := info["server"].Int("uptime_in_seconds"); !ok || n != 42 {
+		t.Errorf("test failed, expected: %d, got: %d", 42, n)
+	}
+	if v := info["keyspace"].Fields("db0")["keys"]; v != "3" {
+		t.Errorf("test failed, expected: %s, got: %s", "3", v)
+	}
+}
+
+func TestParseClientInfo(t *testing.T) {
+	ci := parseClientInfo("id=3 addr=127.0.0.1:50188 laddr=127.0.0.1:6379 fd=8 name=worker age=12 idle=2 flags=N db=1 sub=0 psub=0 ssub=0 multi=-1 qbuf=26 cmd=client|list user=default\n")
+	if ci.ID != 3 || ci.Name != "worker" || ci.Age != 12*time.Second || ci.DB != 1 || ci.Multi != -1 || ci.Cmd != "client|list" || ci.User != "default" {
+		t.Errorf("test failed, got: %+v", ci)
+	}
+	if ci.Fields["qbuf"] != "26" {
+		t.Errorf("test failed, expected: %s, got: %s", "26", ci.Fields["qbuf"])
+	}
+}
+
+func TestFlushAndClientKillArgs(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	client := newFakeClient(t, func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, strings.Join(cmd, " "))
+		if cmd[0] == "CLIENT" {
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client.FlushDB(false)
+	client.FlushAll(true)
+	client.ScriptFlush(false)
+	client.FunctionFlush(true)
+	client.ClientKill(ClientKillArgs{Type: "pubsub"})
+	client.ClientKill(ClientKillArgs{Addr: "127.0.0.1:5000", KillMe: true})
+	if _, err := client.ClientKill(ClientKillArgs{KillMe: true}); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected := "[FLUSHDB FLUSHALL ASYNC SCRIPT FLUSH FUNCTION FLUSH ASYNC CLIENT KILL TYPE pubsub CLIENT KILL ADDR 127.0.0.1:5000 SKIPME no]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, received)
+	}
+}
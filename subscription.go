@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy tells a Subscription what to do with a message when its channel buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the consumer makes room in the buffer, stopping the reader meanwhile
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the message which does not fit in the buffer
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered message to make room for the new one
+	OverflowDropOldest
+)
+
+// SubscriptionOptions configures a Subscription
+type SubscriptionOptions struct {
+	// BufferSize is the capacity of the message channel, 100 by default
+	BufferSize int
+	// Overflow is the policy applied when the message channel is full
+	Overflow OverflowPolicy
+	// PingInterval is how often the connection is checked with a PING, 30 seconds by default,
+	// the connection is considered dead when nothing is received for two intervals.
+	// A negative value disables the check.
+	PingInterval time.Duration
+}
+
+// Subscription delivers the messages of a PubSub on a go channel
+// A reader goroutine receives the messages from the server until the subscription is closed,
+// either by Close or by the cancellation of its context.
+type Subscription struct {
+	ps     *PubSub
+	opts   SubscriptionOptions
+	ch     chan *Message
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	err    error
+}
+
+// Subscribe subscribes a new PubSub to channels and returns a Subscription delivering its messages
+// opts may be nil to use the default options
+func (rc *RedisClient) Subscribe(ctx context.Context, opts *SubscriptionOptions, channels ...string) (*Subscription, error) {
+	ps, err := rc.PubSub()
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) > 0 {
+		if err := ps.Subscribe(channels...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	return ps.Channel(ctx, opts), nil
+}
+
+// Channel starts delivering the messages of the PubSub on a go channel
+// The PubSub is owned by the returned Subscription from then on and must not be read directly,
+// it is closed together with the subscription.
+func (ps *PubSub) Channel(ctx context.Context, opts *SubscriptionOptions) *Subscription {
+	s := &Subscription{
+		ps:   ps,
+		done: make(chan struct{}),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.BufferSize <= 0 {
+		s.opts.BufferSize = 100
+	}
+	if s.opts.PingInterval == 0 {
+		s.opts.PingInterval = 30 * time.Second
+	}
+	s.ch = make(chan *Message, s.opts.BufferSize)
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.read(ctx)
+	go s.watch(ctx)
+	return s
+}
+
+// C returns the channel on which messages are delivered
+// The channel is closed when the subscription ends, Err tells why.
+func (s *Subscription) C() <-chan *Message {
+	return s.ch
+}
+
+// Subscribe subscribes to more channels
+func (s *Subscription) Subscribe(channel ...string) error {
+	return s.ps.Subscribe(channel...)
+}
+
+// Unsubscribe unsubscribes from channels
+func (s *Subscription) Unsubscribe(channel ...string) error {
+	return s.ps.Unsubscribe(channel...)
+}
+
+// PSubscribe subscribes to more patterns
+func (s *Subscription) PSubscribe(pattern ...string) error {
+	return s.ps.PSubscribe(pattern...)
+}
+
+// PUnsubscribe unsubscribes from patterns
+func (s *Subscription) PUnsubscribe(pattern ...string) error {
+	return s.ps.PUnsubscribe(pattern...)
+}
+
+// SSubscribe subscribes to more shard channels
+func (s *Subscription) SSubscribe(shardChannel ...string) error {
+	return s.ps.SSubscribe(shardChannel...)
+}
+
+// SUnsubscribe unsubscribes from shard channels
+func (s *Subscription) SUnsubscribe(shardChannel ...string) error {
+	return s.ps.SUnsubscribe(shardChannel...)
+}
+
+// Publish a message to channel through a connection of the pool
+func (s *Subscription) Publish(channel, message string) error {
+	return s.ps.Publish(channel, message)
+}
+
+// Err returns the error which ended the subscription,
+// nil while it is running or when it was closed normally
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription and waits for its reader to exit
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.Err()
+}
+
+// read receives messages until the connection fails or the subscription is closed
+func (s *Subscription) read(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.ch)
+	defer s.ps.Close()
+	defer s.cancel()
+	for {
+		if s.opts.PingInterval > 0 {
+			s.ps.setReadDeadline(time.Now().Add(2 * s.opts.PingInterval))
+		}
+		// a dead connection is replaced by Receive, which delivers a reconnect message
+		msg, err := s.ps.Receive()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+			return
+		}
+		if msg.Kind == "pong" {
+			continue
+		}
+		s.deliver(ctx, msg)
+	}
+}
+
+func (s *Subscription) deliver(ctx context.Context, msg *Message) {
+	switch s.opts.Overflow {
+	case OverflowDropNewest:
+		select {
+		case s.ch <- msg:
+		default:
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- msg:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- msg:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// watch pings the server periodically, and interrupts the reader when the subscription is closed
+func (s *Subscription) watch(ctx context.Context) {
+	var tick <-chan time.Time
+	if s.opts.PingInterval > 0 {
+		ticker := time.NewTicker(s.opts.PingInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// closing the pubsub interrupts the reader, and prevents it from reconnecting
+			s.ps.Close()
+			return
+		case <-tick:
+			// a failed PING shows up as a read error in the reader
+			s.ps.Ping()
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscription(t *testing.T) {
+	pool := NewConnPool("127.0.0.1", "6379", 1)
+	pool.inUseCnt = 1
+	ps := &PubSub{
+		conn: newTestConn("*3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n"),
+		pool: pool,
+	}
+	sub := ps.Channel(context.Background(), &SubscriptionOptions{PingInterval: -1})
+	<-sub.C()
+	msg := <-sub.C()
+	if msg.Kind != "message" || msg.Payload != "hello" {
+		t.Errorf("test failed, expected: hello message, got: %s", msg)
+	}
+	if err := sub.Close(); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	if _, ok := <-sub.C(); ok {
+		t.Errorf("test failed, expected the channel to be closed")
+	}
+	if pool.inUseCnt != 0 {
+		t.Errorf("test failed, expected the connection to be removed from the pool")
+	}
+
+	// nothing answers the PINGs: the connection is detected as dead
+	pool.inUseCnt = 1
+	ps = &PubSub{conn: newTestConn(""), pool: pool, reconnectAttempts: -1}
+	sub = ps.Channel(context.Background(), &SubscriptionOptions{PingInterval: 10 * time.Millisecond})
+	if _, ok := <-sub.C(); ok {
+		t.Errorf("test failed, expected the channel to be closed")
+	}
+	if sub.Err() == nil {
+		t.Errorf("test failed, expected an error, got: nil")
+	}
+}
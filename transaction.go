@@ -1,62 +1,210 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrTxFailed is returned when EXEC is aborted because one of the watched keys has been modified
+var ErrTxFailed = errors.New("transaction failed: watched key has been modified")
+
+// ErrTxDone is returned when a transaction is used after it has been executed or closed
+var ErrTxDone = errors.New("transaction has already been executed or closed")
+
 // Transaction represents a redis transaction
 type Transaction struct {
-	conn    Conn
-	pool    *ConnPool
+	conn Conn
+	pool *ConnPool
+	// MULTI has been sent, commands are being queued
 	started bool
+	// keys are watched on the connection
+	watching bool
+	// EXEC has been sent
+	executed bool
+	closed   bool
+	// the network error which left the connection unusable, it is closed instead of being put back
+	err error
+	// number of commands queued since MULTI
+	queued int
+	// scripts queued with AddScript
+	scripts []queuedScript
+}
+
+// send one command and read its reply, remembering whether the connection is still usable
+func (tx *Transaction) do(commandSlice ...string) (*Reply, error) {
+	if tx.closed {
+		return nil, ErrTxDone
+	}
+	if err := tx.conn.SendCommand(commandSlice...); err != nil {
+		tx.err = err
+		return nil, err
+	}
+	reply, err := tx.conn.ReadResp()
+	if _, ok := err.(RedisError); err != nil && !ok {
+		tx.err = err
+	}
+	return reply, err
+}
+
+// Do executes one command immediately on the connection of the transaction
+// It is meant for the read phase of an optimistic-locking transaction, after Watch and before MULTI
+func (tx *Transaction) Do(command string, args ...string) (*Reply, error) {
+	if tx.started {
+		return nil, errors.New("command can not be executed immediately inside MULTI, use AddCommand")
+	}
+	return tx.do(append([]string{command}, args...)...)
 }
 
 // AddCommand adds one command to current transaction
 func (tx *Transaction) AddCommand(command string, args ...string) error {
+	if tx.executed {
+		return ErrTxDone
+	}
 	commandSlice := append([]string{command}, args...)
 	if !tx.started {
-		tx.started = true
-		if err := tx.conn.SendCommand("MULTI"); err != nil {
+		if _, err := tx.do("MULTI"); err != nil {
 			return err
 		}
-		tx.conn.ReadResp()
+		tx.started = true
 	}
-	tx.conn.SendCommand(commandSlice...)
-	_, err := tx.conn.ReadResp()
+	tx.queued++
+	_, err := tx.do(commandSlice...)
 	return err
 }
 
 // Watch marks the given keys to be watched for conditional execution of a transaction
 func (tx *Transaction) Watch(keys ...string) error {
 	commandSlice := append([]string{"WATCH"}, keys...)
-	tx.conn.SendCommand(commandSlice...)
-	_, err := tx.conn.ReadResp()
-	return err
+	if _, err := tx.do(commandSlice...); err != nil {
+		return err
+	}
+	tx.watching = true
+	return nil
 }
 
 // Unwatch flushes all the previously watched keys for a transaction
 func (tx *Transaction) Unwatch() error {
-	tx.conn.SendCommand("UNWATCH")
-	_, err := tx.conn.ReadResp()
-	return err
+	if _, err := tx.do("UNWATCH"); err != nil {
+		return err
+	}
+	tx.watching = false
+	return nil
 }
 
 // Exec executes all previously queued commands in a transaction and restores the connection state to normal.
+// returns ErrTxFailed when the transaction was aborted because a watched key has been modified,
+// and ErrTxDone when the transaction has already been executed
 func (tx *Transaction) Exec() ([]*Reply, error) {
-	if err := tx.conn.SendCommand("EXEC"); err != nil {
-		return nil, err
+	if tx.executed || tx.closed {
+		return nil, ErrTxDone
 	}
-	reply, err := tx.conn.ReadResp()
+	if !tx.started {
+		return nil, errors.New("no command has been queued in the transaction")
+	}
+	// EXEC ends the transaction and unwatches every key, whatever its result
+	tx.started = false
+	tx.watching = false
+	tx.executed = true
+	reply, err := tx.do("EXEC")
 	if err != nil {
 		return nil, err
 	}
+	// a null array means the transaction was aborted,
+	// an empty transaction returns an empty array instead
+	if reply.arrayVal == nil {
+		return nil, ErrTxFailed
+	}
+	if len(tx.scripts) > 0 {
+		errs := make([]error, 0, len(reply.arrayVal))
+		for _, r := range reply.arrayVal {
+			errs = append(errs, r.errorVal)
+		}
+		trackScripts(tx.pool, tx.scripts, errs)
+	}
 	return reply.arrayVal, nil
 }
 
 // Discard flushes all previously queued commands in a transaction and restores the connection state to normal.
 func (tx *Transaction) Discard() error {
-	tx.conn.SendCommand("DISCARD")
-	_, err := tx.conn.ReadResp()
-	return err
+	if _, err := tx.do("DISCARD"); err != nil {
+		return err
+	}
+	// DISCARD unwatches every key as well
+	tx.started = false
+	tx.queued = 0
+	tx.scripts = nil
+	tx.watching = false
+	return nil
 }
 
 // Close the underlying connection of the transaction
+// An open MULTI is discarded and watched keys are unwatched before the connection goes back to the pool,
+// the connection is closed instead when that fails
 func (tx *Transaction) Close() {
-	tx.pool.ReleaseConn(tx.conn)
+	if tx.closed {
+		return
+	}
+	var err error
+	if tx.started {
+		err = tx.Discard()
+	} else if tx.watching {
+		err = tx.Unwatch()
+	}
+	tx.closed = true
+	if err != nil && tx.err == nil {
+		// the server refused DISCARD or UNWATCH, the state of the connection is unknown
+		tx.pool.RemoveConn(tx.conn)
+		return
+	}
+	tx.pool.putConn(tx.conn, tx.err)
+}
+
+// Watch runs fn in an optimistic-locking transaction on keys.
+// fn reads the watched keys with tx.Do and queues its writes with tx.AddCommand,
+// the writes are executed atomically by EXEC only if none of the keys was modified in the meantime.
+// When EXEC is aborted the whole transaction, fn included, is retried with backoff
+// until the attempts configured by WithTxRetry are used up, then ErrTxFailed is returned.
+// An error returned by fn aborts the transaction and is returned as is.
+func (rc *RedisClient) Watch(ctx context.Context, fn func(tx *Transaction) error, keys ...string) error {
+	if len(keys) == 0 {
+		return errors.New("no key to watch")
+	}
+	backoff := rc.txRetryBackoff
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := rc.runWatched(fn, keys)
+		if err != ErrTxFailed || attempt >= rc.txMaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (rc *RedisClient) runWatched(fn func(tx *Transaction) error, keys []string) error {
+	tx, err := rc.Transaction()
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	if err := tx.Watch(keys...); err != nil {
+		return err
+	}
+	// Close discards the transaction and unwatches the keys when fn fails
+	if err := fn(tx); err != nil {
+		return err
+	}
+	// nothing was queued, there is no MULTI to execute
+	if !tx.started {
+		return nil
+	}
+	_, err = tx.Exec()
+	return err
 }
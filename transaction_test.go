@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	value, queued := "10", ""
+	// a write outside of a transaction since WATCH aborts the next EXEC
+	dirty := false
+	var seen []string
+	client := newFakeClient(t, func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, cmd[0])
+		switch cmd[0] {
+		case "WATCH":
+			dirty = false
+		case "GET":
+			return bulk(value)
+		case "INCR":
+			n, _ := strconv.Atoi(value)
+			value = strconv.Itoa(n + 1)
+			dirty = true
+			return ":" + value + "\r\n"
+		case "SET":
+			queued = cmd[2]
+			return "+QUEUED\r\n"
+		case "EXEC":
+			if dirty {
+				return "*-1\r\n"
+			}
+			value = queued
+			return "*1\r\n+OK\r\n"
+		}
+		return "+OK\r\n"
+	}, WithTxRetry(5, 2*time.Millisecond))
+	double := func(tx *Transaction) error {
+		reply, err := tx.Do("GET", "counter")
+		if err != nil {
+			return err
+		}
+		n, _ := strconv.Atoi(string(reply.stringVal))
+		return tx.AddCommand("SET", "counter", strconv.Itoa(n*2))
+	}
+	if err := client.Watch(context.Background(), double, "counter"); err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	mu.Lock()
+	if expected := "[WATCH GET MULTI SET EXEC]"; fmt.Sprint(seen) != expected {
+		t.Errorf("test failed, expected: %s, got: %v", expected, seen)
+	}
+	if value != "20" {
+		t.Errorf("test failed, expected: 20, got: %s", value)
+	}
+	mu.Unlock()
+
+	// the watched key is modified during the first two attempts, the third one succeeds after two backoffs
+	attempts := 0
+	start := time.Now()
+	err := client.Watch(context.Background(), func(tx *Transaction) error {
+		attempts++
+		if attempts <= 2 {
+			client.Incr("counter")
+		}
+		return double(tx)
+	}, "counter")
+	if err != nil {
+		t.Errorf("test failed, expected nil, got: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("test failed, expected: 3 attempts, got: %d", attempts)
+	}
+	if d := time.Since(start); d < 6*time.Millisecond {
+		t.Errorf("test failed, expected: backoff of 2ms then 4ms, got: %s", d)
+	}
+	mu.Lock()
+	if value != "44" {
+		t.Errorf("test failed, expected: 44, got: %s", value)
+	}
+	mu.Unlock()
+
+	// modifying the watched key inside fn aborts every attempt
+	attempts = 0
+	err = client.Watch(context.Background(), func(tx *Transaction) error {
+		attempts++
+		client.Incr("counter")
+		return tx.AddCommand("SET", "counter", "0")
+	}, "counter")
+	if err != ErrTxFailed {
+		t.Errorf("test failed, expected: %s, got: %v", ErrTxFailed, err)
+	}
+	if attempts != 5 {
+		t.Errorf("test failed, expected: 5 attempts, got: %d", attempts)
+	}
+}
+
+func TestTransactionState(t *testing.T) {
+	pool := NewConnPool("127.0.0.1", "6379", 2)
+	pool.inUseCnt = 2
+	tx := &Transaction{
+		conn: newTestConn("+OK\r\n+QUEUED\r\n*1\r\n+OK\r\n"),
+		pool: pool,
+	}
+	tx.AddCommand("SET", "x", "1")
+	if _, err := tx.Exec(); err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if _, err := tx.Exec(); err != ErrTxDone {
+		t.Errorf("test failed, expected: %s, got: %v", ErrTxDone, err)
+	}
+	tx.Close()
+	if pool.idleList.length() != 1 {
+		t.Errorf("test failed, expected the connection back in the pool")
+	}
+
+	// MULTI left open and DISCARD failing: the connection must not go back to the pool
+	conn := newTestConn("+OK\r\n+QUEUED\r\n")
+	tx = &Transaction{conn: conn, pool: pool}
+	tx.AddCommand("SET", "x", "1")
+	conn.conn.Close()
+	tx.Close()
+	if pool.idleList.length() != 1 || pool.inUseCnt != 0 {
+		t.Errorf("test failed, expected the connection to be dropped")
+	}
+}
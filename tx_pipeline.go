@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TxAbortError is returned when EXEC is aborted with EXECABORT because the server refused to queue a command
+type TxAbortError struct {
+	// Index of the first refused command in the transaction
+	Index int
+	// Args of the refused command
+	Args []string
+	// Err is the error the server replied instead of QUEUED
+	Err error
+}
+
+func (e *TxAbortError) Error() string {
+	return fmt.Sprintf("transaction aborted, command #%d %s refused: %s", e.Index, strings.ToUpper(e.Args[0]), e.Err)
+}
+
+// Unwrap returns the error of the refused command
+func (e *TxAbortError) Unwrap() error {
+	return e.Err
+}
+
+// TxPipeline represents a redis transaction sent in one round trip:
+// MULTI, the queued commands and EXEC are written to the server at once
+type TxPipeline struct {
+	conn Conn
+	pool *ConnPool
+	cmds []*Cmd
+	// scripts queued with AddScript
+	scripts []queuedScript
+	hooks   []Hook
+	// the error which left the connection out of sync, it is closed instead of being put back
+	err error
+}
+
+// TxPipeline returns a new pipelined transaction
+func (rc *RedisClient) TxPipeline() (*TxPipeline, error) {
+	c, err := rc.pool.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	return &TxPipeline{
+		conn:  c,
+		pool:  rc.pool,
+		hooks: rc.hooks,
+	}, nil
+}
+
+// AddCommand queues one command in the transaction
+// returns the Cmd holding the result of the command after Exec
+func (tp *TxPipeline) AddCommand(command string, args ...string) *Cmd {
+	cmd := newCmd(command, args...)
+	tp.cmds = append(tp.cmds, cmd)
+	return cmd
+}
+
+// Exec sends the transaction and waits for its result
+// returns the queued commands, in order, with their results filled in.
+// returns a *TxAbortError when a command was refused while queuing,
+// and ErrTxFailed when EXEC was aborted because a watched key has been modified.
+func (tp *TxPipeline) Exec() ([]*Cmd, error) {
+	cmds := tp.cmds
+	tp.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	if len(tp.hooks) == 0 {
+		return tp.exec(cmds)
+	}
+	var res []*Cmd
+	err := processCmds(tp.hooks, cmds, func() error {
+		var err error
+		res, err = tp.exec(cmds)
+		return err
+	})
+	return res, err
+}
+
+func (tp *TxPipeline) exec(cmds []*Cmd) ([]*Cmd, error) {
+	scripts := tp.scripts
+	tp.scripts = nil
+	bulkCmd := make([][]string, 0, len(cmds)+2)
+	bulkCmd = append(bulkCmd, []string{"MULTI"})
+	for _, cmd := range cmds {
+		bulkCmd = append(bulkCmd, cmd.args)
+	}
+	bulkCmd = append(bulkCmd, []string{"EXEC"})
+	if err := tp.conn.SendBulkCommand(bulkCmd); err != nil {
+		tp.err = err
+		return nil, err
+	}
+
+	// every reply has to be read, even after an error, to keep the connection usable
+	_, multiErr := tp.conn.ReadResp()
+	if _, ok := multiErr.(RedisError); multiErr != nil && !ok {
+		tp.err = multiErr
+		return nil, multiErr
+	}
+	var abortErr *TxAbortError
+	for i, cmd := range cmds {
+		reply, err := tp.conn.ReadResp()
+		if err != nil {
+			if _, ok := err.(RedisError); !ok {
+				tp.err = err
+				return nil, err
+			}
+			cmd.err = err
+			if abortErr == nil {
+				abortErr = &TxAbortError{Index: i, Args: cmd.args, Err: err}
+			}
+			continue
+		}
+		if string(reply.stringVal) != "QUEUED" {
+			// the replies of the other commands and of EXEC are left unread
+			tp.err = fmt.Errorf("unexpected reply to queued command #%d: %q", i, reply.stringVal)
+			return nil, tp.err
+		}
+	}
+	reply, err := tp.conn.ReadResp()
+	if multiErr != nil {
+		return nil, multiErr
+	}
+	if err != nil {
+		if _, ok := err.(RedisError); ok && abortErr != nil {
+			for _, cmd := range cmds {
+				if cmd.err == nil {
+					cmd.err = abortErr
+				}
+			}
+			return cmds, abortErr
+		}
+		if _, ok := err.(RedisError); !ok {
+			tp.err = err
+		}
+		return nil, err
+	}
+	if reply.arrayVal == nil {
+		for _, cmd := range cmds {
+			cmd.err = ErrTxFailed
+		}
+		return cmds, ErrTxFailed
+	}
+	if len(reply.arrayVal) != len(cmds) {
+		tp.err = errors.New("number of EXEC results does not match the queued commands")
+		return nil, tp.err
+	}
+	errs := make([]error, 0, len(cmds))
+	for i, r := range reply.arrayVal {
+		cmds[i].setReply(r)
+		errs = append(errs, cmds[i].err)
+	}
+	trackScripts(tp.pool, scripts, errs)
+	return cmds, nil
+}
+
+// Close the underlying connection of the transaction, it is closed instead of being put back if it is out of sync
+func (tp *TxPipeline) Close() {
+	tp.pool.putConn(tp.conn, tp.err)
+}
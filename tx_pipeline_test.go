@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTxPipeline(t *testing.T) {
+	tp := &TxPipeline{
+		conn: newTestConn("+OK\r\n+QUEUED\r\n+QUEUED\r\n+QUEUED\r\n*3\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"),
+		pool: NewConnPool("127.0.0.1", "6379", 1),
+	}
+	set := tp.AddCommand("SET", "x", "1")
+	incr := tp.AddCommand("INCR", "x")
+	lpush := tp.AddCommand("LPUSH", "x", "a")
+	cmds, err := tp.Exec()
+	if err != nil {
+		t.Fatalf("test failed, expected nil, got: %s", err)
+	}
+	if len(cmds) != 3 {
+		t.Fatalf("test failed, expected: 3 results, got: %d", len(cmds))
+	}
+	if s, _ := set.Text(); s != "OK" {
+		t.Errorf("test failed, expected: OK, got: %s", s)
+	}
+	if n, _ := incr.Int64(); n != 2 {
+		t.Errorf("test failed, expected: 2, got: %d", n)
+	}
+	if _, ok := lpush.Err().(RedisError); !ok {
+		t.Errorf("test failed, expected a RedisError, got: %v", lpush.Err())
+	}
+
+	tp.conn = newTestConn("+OK\r\n+QUEUED\r\n-ERR unknown command 'foo'\r\n-EXECABORT Transaction discarded because of previous errors.\r\n")
+	tp.AddCommand("SET", "x", "1")
+	tp.AddCommand("foo")
+	_, err = tp.Exec()
+	abortErr, ok := err.(*TxAbortError)
+	if !ok {
+		t.Fatalf("test failed, expected a *TxAbortError, got: %v", err)
+	}
+	if abortErr.Index != 1 {
+		t.Errorf("test failed, expected: 1, got: %d", abortErr.Index)
+	}
+
+	tp.conn = newTestConn("+OK\r\n+QUEUED\r\n*-1\r\n")
+	tp.AddCommand("SET", "x", "1")
+	if _, err = tp.Exec(); err != ErrTxFailed {
+		t.Errorf("test failed, expected: %s, got: %v", ErrTxFailed, err)
+	}
+
+	// the reply of EXEC is left unread, the connection is not put back
+	tp.conn = newTestConn("+OK\r\n+OK\r\n*1\r\n+OK\r\n")
+	tp.pool.inUseCnt = 1
+	tp.AddCommand("SET", "x", "1")
+	if _, err = tp.Exec(); err == nil {
+		t.Errorf("test failed, expected error, got nil")
+	}
+	tp.Close()
+	if stats := tp.pool.Stats(); stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("test failed, expected: no connection, got: %+v", stats)
+	}
+}